@@ -0,0 +1,73 @@
+/*
+ * Copyright (c) 2017 Crimson AS <info@crimson.no>
+ * Author: Robin Burchell <robin.burchell@crimson.no>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package go262
+
+// How many of a WorkerPool's workers a job using $262.agent occupies: the
+// main agent, and the agents it starts alongside it.
+const AgentJobWeight = 4
+
+// Whether the test runs several agents at once, through $262.agent
+func (testcase *TestCase) IsMultiAgent() bool {
+	for _, c := range testcase.HostCapabilities() {
+		if c == "agent" {
+			return true
+		}
+	}
+	return false
+}
+
+// How many of a pool's workers the job occupies while it runs
+func (job *TestJob) Weight() int {
+	if job.TestCase.IsMultiAgent() {
+		return AgentJobWeight
+	}
+	return 1
+}
+
+// Returns the arguments to run the test with in a run type, choosing whether
+// the main thread can block (see CanBlockIsTrueFlag and CanBlockIsFalseFlag).
+// If the engine can't be made to block (or not) as the test wants, the flag is
+// returned too, and the test can't run.
+func (engine *Engine) argsFor(testcase *TestCase, runType string) ([]string, string) {
+	args := append([]string{}, engine.Args...)
+	if _, name := SplitRunType(runType); len(name) > 0 {
+		if variant := engine.Variant(name); variant != nil {
+			args = append(args, variant.Args...)
+		}
+	}
+
+	if testcase.HasFlag(CanBlockIsTrueFlag) && !engine.MainCanBlock {
+		if engine.CanBlockArgs == nil {
+			return nil, CanBlockIsTrueFlag
+		}
+		args = append(args, engine.CanBlockArgs...)
+	} else if testcase.HasFlag(CanBlockIsFalseFlag) && engine.MainCanBlock {
+		if engine.CannotBlockArgs == nil {
+			return nil, CanBlockIsFalseFlag
+		}
+		args = append(args, engine.CannotBlockArgs...)
+	}
+
+	return args, ""
+}
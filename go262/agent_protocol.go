@@ -0,0 +1,185 @@
+/*
+ * Copyright (c) 2017 Crimson AS <info@crimson.no>
+ * Author: Robin Burchell <robin.burchell@crimson.no>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package go262
+
+// go262 implements $262.agent itself for engines that can run workers, given
+// a small hook script for the engine (see Engine.AgentHook). The hook defines
+// go262AgentHook, which on the main thread has:
+//
+//	start(source): starts a worker running the script source, and returns
+//	an object with post(message), sending message to the worker. Messages
+//	hold SharedArrayBuffers, which must be shared with the worker, not
+//	copied.
+//
+// and in the workers it starts, where source can see it too:
+//
+//	receive(callback): calls callback with each message posted to the
+//	worker, in order.
+//
+// Everything else is built on those, and on SharedArrayBuffer and Atomics:
+// reports are queued in shared memory, so that getReport needn't wait for
+// the main thread's event loop, and broadcast waits until every agent has
+// received the message.
+
+// The name the agent implementation is known by in the harness
+const agentProtocolName = "go262-agent.js"
+
+// The agent implementation, loaded after the engine's agent hook
+const agentProtocolSource = `// $262.agent, built on go262AgentHook (see go262/agent_protocol.go)
+function go262Agent(hook, isAgent) {
+    // The shared state: a lock, how many agents received the last
+    // broadcast, where the report queue starts and ends, and the queue of
+    // reports, each its length followed by its UTF-16 code units
+    var LOCK = 0, RECEIVED = 1, HEAD = 2, TAIL = 3, QUEUE = 4;
+    var QUEUE_SIZE = 65536;
+
+    function monotonicNow() {
+        if (typeof performance === "object" && typeof performance.now === "function") {
+            return performance.now();
+        }
+        return Date.now();
+    }
+
+    function sleep(ms) {
+        try {
+            Atomics.wait(new Int32Array(new SharedArrayBuffer(4)), 0, 0, ms);
+        } catch (e) {
+            // This thread can't block
+            var end = monotonicNow() + ms;
+            while (monotonicNow() < end) {
+            }
+        }
+    }
+
+    function lock(shared) {
+        while (Atomics.compareExchange(shared, LOCK, 0, 1) !== 0) {
+        }
+    }
+
+    function unlock(shared) {
+        Atomics.store(shared, LOCK, 0);
+    }
+
+    if (isAgent) {
+        var shared = null, pending = [], broadcasts = [], callback = null;
+
+        var write = function (report) {
+            lock(shared);
+            var tail = shared[TAIL];
+            if (tail + 1 + report.length > QUEUE_SIZE) {
+                unlock(shared);
+                throw new Error("go262: too many agent reports");
+            }
+            shared[QUEUE + tail] = report.length;
+            for (var i = 0; i < report.length; i++) {
+                shared[QUEUE + tail + 1 + i] = report.charCodeAt(i);
+            }
+            shared[TAIL] = tail + 1 + report.length;
+            unlock(shared);
+        };
+
+        hook.receive(function (message) {
+            if (message.go262Queue) {
+                shared = new Int32Array(message.go262Queue);
+                pending.forEach(write);
+                pending = [];
+                return;
+            }
+            Atomics.add(shared, RECEIVED, 1);
+            if (callback) {
+                callback(message.sab, message.id);
+            } else {
+                broadcasts.push(message);
+            }
+        });
+
+        return {
+            receiveBroadcast: function (cb) {
+                callback = cb;
+                broadcasts.splice(0).forEach(function (message) {
+                    callback(message.sab, message.id);
+                });
+            },
+            report: function (value) {
+                if (shared) {
+                    write(String(value));
+                } else {
+                    // Not set up yet; reports are sent once it is
+                    pending.push(String(value));
+                }
+            },
+            leaving: function () {
+            },
+            sleep: sleep,
+            monotonicNow: monotonicNow
+        };
+    }
+
+    var queue = new Int32Array(new SharedArrayBuffer((QUEUE + QUEUE_SIZE) * 4));
+    var agents = [];
+    var agentPrelude = "var $262 = typeof $262 === \"object\" ? $262 : {};\n" +
+        "$262.agent = (" + go262Agent + ")(go262AgentHook, true);\n";
+
+    return {
+        start: function (source) {
+            var agent = hook.start(agentPrelude + source);
+            agent.post({ go262Queue: queue.buffer });
+            agents.push(agent);
+        },
+        broadcast: function (sab, id) {
+            Atomics.store(queue, RECEIVED, 0);
+            agents.forEach(function (agent) {
+                agent.post({ sab: sab, id: id });
+            });
+            // Block until every agent got it, without Atomics.wait, which
+            // the main thread may not be able to do
+            while (Atomics.load(queue, RECEIVED) < agents.length) {
+            }
+        },
+        getReport: function () {
+            lock(queue);
+            var head = queue[HEAD];
+            if (head === queue[TAIL]) {
+                unlock(queue);
+                return null;
+            }
+            var report = "";
+            var length = queue[QUEUE + head];
+            for (var i = 0; i < length; i++) {
+                report += String.fromCharCode(queue[QUEUE + head + 1 + i]);
+            }
+            queue[HEAD] = head + 1 + length;
+            unlock(queue);
+            return report;
+        },
+        sleep: sleep,
+        monotonicNow: monotonicNow
+    };
+}
+
+if (typeof $262 !== "object") {
+    var $262 = {};
+}
+$262.agent = go262Agent(go262AgentHook, false);
+`
@@ -24,10 +24,11 @@
 package go262
 
 import (
-	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"io/ioutil"
+	"log"
 	"os"
-	"os/exec"
 	"path"
 	"sync"
 	"time"
@@ -41,9 +42,6 @@ type TestCase struct {
 	// The metadata of this test
 	Metadata TestMetadata
 
-	// The data of this test
-	TestData string
-
 	// All the suites associated with this test
 	Suites []*TestSuite
 
@@ -53,10 +51,43 @@ type TestCase struct {
 	// under caseLock.
 	lastResults map[string]*TestResult
 
-	// Lock access to lastResults
+	// Lock access to lastResults, reductions, engineResults, includeError
+	// and changedOnDisk
 	caseLock sync.Mutex
 
 	global *GlobalState
+
+	// Hash of the file's contents when it was parsed, and the modification
+	// time and size of the file, for rescanning.
+	contentHash string
+	modTime     time.Time
+	size        int64
+
+	// Where the data of this test starts in the file (see TestData), and the
+	// line it starts at
+	dataOffset int
+	dataLine   int
+
+	// The $262 capabilities the test's own code uses (see HostCapabilities)
+	hostCapabilities []string
+
+	// The last reduction for each run type (see Reduce). Access under
+	// caseLock.
+	reductions map[string]*Reduction
+
+	// The results of the last runs with the engines besides the main one
+	// (see AddEngine).
+	// Engine -> RunType -> result
+	// Access under caseLock.
+	engineResults map[*Engine]map[string]*TestResult
+
+	// Why the test's includes can't be resolved, if they can't (see
+	// verifyIncludes). Access under caseLock.
+	includeError error
+
+	// Whether the file no longer has the contents it was parsed from, when
+	// it was last read (see TestData). Access under caseLock.
+	changedOnDisk bool
 }
 
 // The in-line metadata related to this test. See the test262 documentation for
@@ -82,9 +113,17 @@ type TestMetadata struct {
 const StrictFlag = "onlyStrict"
 const NonStrictFlag = "noStrict"
 const RawFlag = "raw"
+const ModuleFlag = "module"
+const AsyncFlag = "async"
+const GeneratedFlag = "generated"
+const CanBlockIsFalseFlag = "CanBlockIsFalse"
+const CanBlockIsTrueFlag = "CanBlockIsTrue"
+const NonDeterministicFlag = "non-deterministic"
 
 // Negative.Phase
 const EarlyPhase = "early"
+const ParsePhase = "parse" // newer test262 name for early
+const ResolutionPhase = "resolution"
 const RuntimePhase = "runtime"
 
 // Used to request a specific "job" for a test case. This is needed as tests can
@@ -122,14 +161,23 @@ func (testcase *TestCase) IsNegative() bool {
 	return false
 }
 
-func (suite *TestSuite) createTestCase(pathName string) {
+func (suite *TestSuite) createTestCase(pathName string) *TestCase {
 	test := &TestCase{pathName,
 		TestMetadata{},
-		"",
 		[]*TestSuite{},
 		map[string]*TestResult{},
 		sync.Mutex{},
 		suite.global,
+		"",
+		time.Time{},
+		0,
+		0,
+		1,
+		nil,
+		map[string]*Reduction{},
+		map[*Engine]map[string]*TestResult{},
+		nil,
+		false,
 	}
 
 	suite.global.testMap[pathName] = test
@@ -146,6 +194,8 @@ func (suite *TestSuite) createTestCase(pathName string) {
 		test.Suites = append(test.Suites, suite)
 		pathName = path.Dir(pathName)
 	}
+
+	return test
 }
 
 func (testcase *TestCase) SuiteDir() string {
@@ -169,7 +219,15 @@ func (testcase *TestCase) Parse() {
 		panic(err)
 	}
 	f.Close()
-	testcase.ParseMetadata(string(bytes))
+	testcase.parseContents(bytes)
+}
+
+func (testcase *TestCase) parseContents(contents []byte) {
+	testcase.contentHash = hashSource(string(contents))
+	testcase.hostCapabilities = findHostCapabilities(string(contents))
+	if err := testcase.ParseMetadata(string(contents)); err != nil {
+		log.Printf("Invalid testcase %s: %s", testcase.PathName, err.Error())
+	}
 	testcase.verifyIncludes()
 }
 
@@ -183,97 +241,192 @@ func (testcase *TestCase) HasFlag(str string) bool {
 	return false
 }
 
-func (testcase *TestCase) GetSource(job *TestJob) string {
+// The code run for a job. The harness is either put in the same script as the
+// test, or, for engines taking several scripts, given as a script of its own
+// so that it doesn't offset the lines of the test.
+type jobSource struct {
+	// The harness, if it is a separate script
+	prelude *sourceBuilder
+
+	// The test, after the harness if that isn't separate
+	test *sourceBuilder
+}
+
+// A script given to the engine
+type SourceFile struct {
+	Name   string
+	Source string
+}
+
+// Returns the scripts run, in order: the prelude, if it is separate, as
+// prelude.js, then the test as test.js. A separate prelude isn't joined to the
+// test, as "use strict" only works at the start of the test's own script.
+func (src *jobSource) files() []SourceFile {
+	files := []SourceFile{}
+	if src.prelude != nil {
+		files = append(files, SourceFile{"prelude.js", src.prelude.source})
+	}
+	return append(files, SourceFile{"test.js", src.test.source})
+}
+
+// Hash of the scripts run. A test without a separate prelude hashes as its
+// source alone.
+func (src *jobSource) hash() string {
+	if src.prelude == nil {
+		return hashSource(src.test.source)
+	}
+	return hashSource(hashSource(src.prelude.source) + hashSource(src.test.source))
+}
+
+// Rewrite positions in the output of the engine to the original files, given
+// the names the engine knew the scripts by.
+func (src *jobSource) rewrite(output string, preludeName string, testName string) string {
+	if src.prelude != nil {
+		output = src.prelude.m.rewrite(output, preludeName)
+	}
+	return src.test.m.rewrite(output, testName)
+}
+
+// Build the code run for a job with engine, with data as the test's own code
+// (normally TestData).
+func (testcase *TestCase) buildSource(job *TestJob, engine *Engine, data string) *jobSource {
+	src := &jobSource{nil, &sourceBuilder{}}
+
 	// Get source
 	if testcase.HasFlag(RawFlag) {
-		return testcase.TestData
+		src.test.add(data, testcase.PathName, testcase.dataLine)
+		return src
 	}
 
-	source := ""
-
-	if job.RunType == "strict" {
-		source = `"use strict";`
-		source += "\nvar strict_mode = true;\n"
-	} else if job.RunType == "nonstrict" {
+	mode, _ := SplitRunType(job.RunType)
+	if mode == "strict" {
+		src.test.add("\"use strict\";\nvar strict_mode = true;\n", "", 0)
+	} else if mode == "nonstrict" {
 		// Add a comment to get the line numbers to match
-		source = `//"no strict";`
-		source += "\nvar strict_mode = false;\n"
+		src.test.add("//\"no strict\";\nvar strict_mode = false;\n", "", 0)
 	} else {
 		panic("Unknown job type " + job.RunType)
 	}
 
-	if testcase.Metadata.Negative.Phase == EarlyPhase {
-		source += "throw 'Expected an early error, but code was executed.';\n"
+	if testcase.Metadata.Negative.Phase == EarlyPhase || testcase.Metadata.Negative.Phase == ParsePhase {
+		src.test.add("throw 'Expected an early error, but code was executed.';\n", "", 0)
 	}
 
-	// No need to check the include cache at this point. verifyIncludes
-	// should have already caught any problem.
-	_, inc := testcase.global.fetchFromIncludeCache("sta.js")
-	source += inc
-	_, inc = testcase.global.fetchFromIncludeCache("cth.js")
-	source += inc
-	_, inc = testcase.global.fetchFromIncludeCache("assert.js")
-	source += inc
-
 	// ###
 	// if IsAsyncTest
 	// read timer.js
 	// doneprintHandle.js .replace('print', self.suite.print_handle
 
-	// Specific test includes
-	for _, inc := range testcase.Metadata.Includes {
-		_, incsource := testcase.global.fetchFromIncludeCache(inc)
-		source += incsource + "\n"
+	if engine.SeparateScripts {
+		src.prelude = testcase.harnessPrelude(engine)
+	} else {
+		src.test.addBuilt(testcase.harnessPrelude(engine))
 	}
+	src.test.add(data, testcase.PathName, testcase.dataLine)
 
-	source += testcase.TestData
+	return src
+}
 
-	return source
+// Returns the scripts run for a job (see jobSource.files).
+func (testcase *TestCase) GetSource(job *TestJob) []SourceFile {
+	return testcase.buildSource(job, testcase.global.engine, testcase.TestData()).files()
 }
 
 // Runs the job (in a blocking manner), and return a result.
 func (testcase *TestCase) Run(job *TestJob) *TestResult {
+	tr := testcase.run(job)
+	testcase.setLastResult(tr)
+	return tr
+}
+
+func (testcase *TestCase) setLastResult(tr *TestResult) {
+	testcase.caseLock.Lock()
+	testcase.lastResults[tr.RunType] = tr
+	testcase.caseLock.Unlock()
+}
+
+// Runs the job without recording the result.
+func (testcase *TestCase) run(job *TestJob) *TestResult {
+	return testcase.runWith(testcase.global.engine, job, testcase.TestData())
+}
+
+// Runs the job with engine, with data in place of the test's own code,
+// without recording the result.
+func (testcase *TestCase) runWith(engine *Engine, job *TestJob, data string) *TestResult {
 	//fmt.Printf("Running %s\n", testcase.FileName())
-	tmpfile, err := ioutil.TempFile("", "example")
-	if err != nil {
-		panic("can't get tempfile! " + err.Error())
+	src := testcase.buildSource(job, engine, data)
+	sourceHash := src.hash()
+	engineHash := engine.runTypeHash(job.RunType)
+	if err := testcase.IncludeError(); err != nil {
+		return &TestResult{job, false, err.Error(), "", 0, "", "", nil, false, sourceHash, engineHash, nil}
 	}
-	defer os.Remove(tmpfile.Name())
-	if _, err := tmpfile.Write([]byte(testcase.GetSource(job))); err != nil {
-		panic("can't write tmpfile! " + err.Error())
+	if testcase.isChangedOnDisk() {
+		// Its metadata may be stale, and the result wouldn't be current
+		// anyway, so it has no source hash
+		return &TestResult{job, false, "go262: " + testcase.PathName + " changed since it was parsed, rescan needed\n", "", 0, "", "", nil, false, "", engineHash, nil}
 	}
-	if err := tmpfile.Close(); err != nil {
-		panic("can't close tmpfile! " + err.Error())
+	if missing := testcase.unsupportedRequirements(engine); len(missing) > 0 {
+		return &TestResult{job, false, "", "", 0, "", "", nil, false, sourceHash, engineHash, missing}
 	}
 
 	// Run it
 	startTime := time.Now()
-	cmd := exec.Command("/Users/burchr/code/qt/qtbase/bin/qmljs", tmpfile.Name())
-	var stdout bytes.Buffer
-	var stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
-	err = cmd.Run()
-
+	args, _ := engine.argsFor(testcase, job.RunType)
+	var success bool
+	var stdout, stderr string
+	if engine.usesHost(args) {
+		success, stdout, stderr = engine.runInHost(src)
+	} else {
+		success, stdout, stderr = engine.runProcess(args, src)
+	}
 	//fmt.Printf("Done running %s\n", testcase.FileName())
-	if err != nil {
-		_, ok := err.(*exec.ExitError)
-		if !ok {
-			panic("Fatal error running: " + err.Error())
-		}
+
+	errorType, errorMessage := "", ""
+	if !success {
+		errorType, errorMessage = engine.ParseUncaughtError(stderr)
 	}
 
 	tr := &TestResult{
 		job,
-		err == nil,
-		stderr.String(),
-		stdout.String(),
+		success,
+		stderr,
+		stdout,
 		time.Since(startTime),
+		errorType,
+		errorMessage,
+		nil,
+		false,
+		sourceHash,
+		engineHash,
+		nil,
 	}
 
-	testcase.caseLock.Lock()
-	testcase.lastResults[tr.RunType] = tr
-	testcase.caseLock.Unlock()
+	return tr
+}
+
+// Runs the job (in a blocking manner), rerunning it up to retries times while
+// it fails. All attempts are recorded on the returned result, which is the last
+// attempt, and which is marked Flaky if the outcomes disagreed.
+func (testcase *TestCase) RunWithRetries(job *TestJob, retries int) *TestResult {
+	tr := testcase.runWithRetries(testcase.global.engine, job, retries)
+	testcase.setLastResult(tr)
+	return tr
+}
+
+// Runs the job with engine like RunWithRetries, without recording the result.
+func (testcase *TestCase) runWithRetries(engine *Engine, job *TestJob, retries int) *TestResult {
+	tr := testcase.runWith(engine, job, testcase.TestData())
+	var attempts []*TestResult
+	failed := !tr.IsSuccessful()
+
+	// Retrying won't help when the engine can't run the test at all
+	for i := 0; i < retries && !tr.IsSuccessful() && len(tr.Unsupported) == 0; i++ {
+		attempts = append(attempts, tr.outcome())
+		tr = testcase.runWith(engine, job, testcase.TestData())
+	}
+
+	tr.Attempts = append(attempts, tr)
+	tr.Flaky = failed && tr.IsSuccessful()
 
 	return tr
 }
@@ -285,37 +438,76 @@ func (testcase *TestCase) GetLastResultFor(runType string) *TestResult {
 	return r
 }
 
-// Create a number of TestJob instances for this TestCase.
-func (testcase *TestCase) DetermineRunJobs() []*TestJob {
-	onlyStrict := testcase.HasFlag(StrictFlag)
-	noStrict := testcase.HasFlag(NonStrictFlag)
+func hashSource(source string) string {
+	h := sha256.Sum256([]byte(source))
+	return hex.EncodeToString(h[:])
+}
+
+// Whether the last results for the job were produced from the same source,
+// with the same engines, so running it again would be pointless.
+func (testcase *TestCase) isUnchanged(job *TestJob) bool {
+	for _, engine := range testcase.global.Engines() {
+		if engine.hasRunType(job.RunType) && !testcase.isCurrent(testcase.GetResultWith(engine, job.RunType), engine) {
+			return false
+		}
+	}
+	return true
+}
+
+// Whether res is what running its job with engine would produce now.
+func (testcase *TestCase) isCurrent(res *TestResult, engine *Engine) bool {
+	if res == nil || len(res.SourceHash) == 0 || len(res.EngineHash) == 0 {
+		return false
+	}
+
+	return res.EngineHash == engine.runTypeHash(res.RunType) &&
+		res.SourceHash == testcase.buildSource(res.TestJob, engine, testcase.TestData()).hash()
+}
+
+// Create a number of TestJob instances for this TestCase. Unless force is set,
+// jobs whose source and engine haven't changed since their last result are
+// skipped.
+func (testcase *TestCase) DetermineRunJobs(force bool) []*TestJob {
 	//raw := testcase.HasFlag( RawFlag)
 	//module := testcase.HasFlag( "module")
 	//async := testcase.HasFlag( "async")
 
 	var jobs []*TestJob
 
-	if onlyStrict {
-		jobs = append(jobs, &TestJob{testcase, "strict"})
-	} else if noStrict {
-		jobs = append(jobs, &TestJob{testcase, "nonstrict"})
-	} else {
-		jobs = append(jobs, &TestJob{testcase, "strict"})
-		jobs = append(jobs, &TestJob{testcase, "nonstrict"})
+	// One job per mode, in each of the engine's configurations
+	for _, runType := range testcase.global.RunTypes() {
+		if testcase.HasRunType(runType) {
+			jobs = append(jobs, &TestJob{testcase, runType})
+		}
 	}
 
-	return jobs
+	if force {
+		return jobs
+	}
+
+	var changed []*TestJob
+	for _, job := range jobs {
+		if !testcase.isUnchanged(job) {
+			changed = append(changed, job)
+		}
+	}
+	return changed
 }
 
 func (testcase *TestCase) HasRunType(runType string) bool {
 	onlyStrict := testcase.HasFlag(StrictFlag)
 	noStrict := testcase.HasFlag(NonStrictFlag)
+	mode, _ := SplitRunType(runType)
 
-	if noStrict && runType == "strict" {
+	if (mode != "strict" && mode != "nonstrict") || !testcase.global.engine.hasRunType(runType) {
 		return false
 	}
 
-	if onlyStrict && runType != "strict" {
+	if noStrict && mode == "strict" {
+		return false
+	}
+
+	if onlyStrict && mode != "strict" {
 		return false
 	}
 
@@ -327,23 +519,9 @@ const HasNotRunState = "hasntrun"
 const PartialSuccessState = "mostlygood"
 const SuccessState = "allgood"
 const FailureState = "allbad"
+const FlakyState = "flaky"
+const UnsupportedState = "unsupported"
 
 func (testcase *TestCase) StateValue(runType string) string {
-	// Test doesn't run in this mode
-	if !testcase.HasRunType(runType) || testcase.IsExcluded() {
-		return WillNotRunState
-	}
-
-	testcase.caseLock.Lock()
-	res := testcase.lastResults[runType]
-	testcase.caseLock.Unlock()
-	if res == nil {
-		return HasNotRunState
-	}
-
-	if res.IsSuccessful() {
-		return SuccessState
-	} else {
-		return FailureState
-	}
+	return testcase.StateValueWith(testcase.global.engine, runType)
 }
@@ -24,88 +24,193 @@
 package go262
 
 import (
-	"errors"
+	"fmt"
 	"regexp"
+	"strconv"
+	"strings"
 )
 
-// For YAML parsing out of the testcases.
-// Thanks to parseTestRecord.py.
-// Copyright 2011 by Google, Inc.  All rights reserved.
-const headerPatternStr = "(?:(?:\\s*\\/\\/.*)?\\s*\\n)*"
-const captureCommentPatternStr = "\\/\\*\\*?((?:\\s|\\S)*?)\\*\\/\\s*\\n"
-const anyPatternStr = "(?:\\s|\\S)*"
-
-var headerPattern = regexp.MustCompile("^" + headerPatternStr)
-var testRecordPattern = regexp.MustCompile("^(" + headerPatternStr +
-	")(?:" + captureCommentPatternStr +
-	")?(" + anyPatternStr +
-	")$")
-
-var stars = regexp.MustCompile("\\s*\\n\\s*\\*\\s?")
-var atattrs = regexp.MustCompile("\\s*\\n\\s*\\*\\s*@")
-
-var yamlPattern = regexp.MustCompile("---((?:\\s|\\S)*)---")
-var newlinePattern = regexp.MustCompile("\\n")
-
-func matchParts(src string) ([]string, error) {
-	matches := testRecordPattern.FindStringSubmatch(src)
-	if matches == nil {
-		return nil, errors.New("can't find matchParts")
+// An error in the frontmatter of a test
+type FrontmatterError struct {
+	// The line of the test file the error is on (starting at 1)
+	Line int
+
+	Message string
+}
+
+func (err *FrontmatterError) Error() string {
+	return fmt.Sprintf("line %d: %s", err.Line, err.Message)
+}
+
+// The frontmatter block of a test (/*--- ... ---*/)
+type frontmatter struct {
+	// The YAML inside the block, with line endings normalised
+	yaml string
+
+	// The line of the test file the block starts on
+	line int
+
+	// Where the data of the test starts: after the block if only comments
+	// come before it, or at the start of the file otherwise.
+	dataOffset int
+}
+
+const frontmatterStart = "/*---"
+const frontmatterEnd = "---*/"
+
+// Find the frontmatter of a test. Copyright headers and any other comments
+// before it (line or block, with LF or CRLF line endings) are skipped. Returns
+// nil if there is no frontmatter at all.
+func scanFrontmatter(src string) (*frontmatter, error) {
+	pos := 0
+	line := 1
+	advance := func(to int) {
+		line += strings.Count(src[pos:to], "\n")
+		pos = to
+	}
+
+	if strings.HasPrefix(src, "\ufeff") {
+		advance(len("\ufeff"))
+	}
+
+	for pos < len(src) {
+		rest := src[pos:]
+		switch {
+		case strings.IndexByte(" \t\r\n\f\v", rest[0]) >= 0:
+			advance(pos + 1)
+		case strings.HasPrefix(rest, "//") || (pos == 0 && strings.HasPrefix(rest, "#!")):
+			end := strings.IndexByte(rest, '\n')
+			if end < 0 {
+				end = len(rest)
+			}
+			advance(pos + end)
+		case strings.HasPrefix(rest, frontmatterStart):
+			return readFrontmatter(src, pos, line, true)
+		case strings.HasPrefix(rest, "/*"):
+			end := strings.Index(rest[2:], "*/")
+			if end < 0 {
+				return nil, &FrontmatterError{line, "unterminated comment"}
+			}
+			advance(pos + 2 + end + 2)
+		default:
+			// Code comes first, so the frontmatter (if any) is further
+			// down, on a line of its own.
+			idx := strings.Index(rest, "\n"+frontmatterStart)
+			if idx < 0 {
+				return nil, nil
+			}
+			advance(pos + idx + 1)
+			return readFrontmatter(src, pos, line, false)
+		}
 	}
-	return matches, nil
+
+	return nil, nil
 }
 
-var noYamlErr = errors.New("no YAML found")
+// Read the frontmatter block starting at pos (on line).
+func readFrontmatter(src string, pos int, line int, dataAfter bool) (*frontmatter, error) {
+	start := pos + len(frontmatterStart)
+	end := strings.Index(src[start:], frontmatterEnd)
+	if end < 0 {
+		return nil, &FrontmatterError{line, "unterminated frontmatter, missing " + frontmatterEnd}
+	}
+	end += start
 
-func parseYamlAttr(text string) (error, TestMetadata) {
-	matches := yamlPattern.FindStringSubmatch(text)
-	if matches == nil {
-		return noYamlErr, TestMetadata{}
+	fm := &frontmatter{
+		strings.Replace(src[start:end], "\r\n", "\n", -1),
+		line,
+		0,
 	}
 
-	return load(string(matches[1]))
+	if dataAfter {
+		// Data starts on the line after the block
+		offset := end + len(frontmatterEnd)
+		for offset < len(src) && (src[offset] == ' ' || src[offset] == '\t' || src[offset] == '\r') {
+			offset++
+		}
+		if offset < len(src) && src[offset] == '\n' {
+			offset++
+		}
+		fm.dataOffset = offset
+	}
+
+	return fm, nil
+}
+
+var yamlLinePattern = regexp.MustCompile(`line (\d+)`)
+
+// Turn an error from the YAML parser into one with lines of the test file.
+func yamlError(fm *frontmatter, err error) error {
+	line := fm.line
+	msg := yamlLinePattern.ReplaceAllStringFunc(err.Error(), func(m string) string {
+		n, _ := strconv.Atoi(m[len("line "):])
+		line = fm.line + n - 1
+		return "line " + strconv.Itoa(line)
+	})
+	return &FrontmatterError{line, msg}
 }
 
-func (testcase *TestCase) ParseMetadata(contents string) {
-	match, err := matchParts(contents)
+// Parse the metadata out of the contents of this test's file, and validate it.
+func (testcase *TestCase) ParseMetadata(contents string) error {
+	fm, err := scanFrontmatter(contents)
 	if err != nil {
-		panic("boom, " + testcase.PathName + " -- " + err.Error())
+		return err
+	}
+	if fm == nil {
+		testcase.dataOffset = 0
+		testcase.dataLine = 1
+		return nil
 	}
 
-	// needed?
-	//testcase.TestRecord["header"] = strings.TrimSpace(match[1])
-	testcase.TestData = match[3]
-
-	attrs := match[2]
-	if len(attrs) > 0 {
-		err, meta := parseYamlAttr(attrs)
-		if err != nil {
-			if err == noYamlErr {
-				panic("old attr support needed")
-			} else {
-				panic("boom! " + err.Error())
-			}
-		} else {
-			testcase.Metadata = meta
+	testcase.dataOffset = fm.dataOffset
+	testcase.dataLine = 1 + strings.Count(contents[:fm.dataOffset], "\n")
+	meta, err := load(fm.yaml)
+	if err != nil {
+		return yamlError(fm, err)
+	}
+	testcase.Metadata = meta
+
+	if problems := testcase.validateMetadata(); len(problems) > 0 {
+		return &FrontmatterError{fm.line, problems[0]}
+	}
+
+	// The YAML parser silently keeps the last value
+	if dups, _ := duplicateKeys(fm.yaml); len(dups) > 0 {
+		return &FrontmatterError{fm.keyLine(dups[0]), "Duplicate key " + dups[0]}
+	}
+
+	return nil
+}
+
+// Check the metadata for combinations test262 doesn't allow, returning a
+// description of each problem.
+func (testcase *TestCase) validateMetadata() []string {
+	var problems []string
+
+	if testcase.IsNegative() {
+		if len(testcase.Metadata.Negative.Phase) == 0 || len(testcase.Metadata.Negative.Type) == 0 {
+			problems = append(problems, "Negative tests need both a phase and a type")
 		}
 	}
 
-	// Validate it
 	if len(testcase.Metadata.Negative.Phase) > 0 {
 		if testcase.Metadata.Negative.Phase != EarlyPhase &&
+			testcase.Metadata.Negative.Phase != ParsePhase &&
+			testcase.Metadata.Negative.Phase != ResolutionPhase &&
 			testcase.Metadata.Negative.Phase != RuntimePhase {
-			panic("Invalid testcase. Can't have a negative phase of " + testcase.Metadata.Negative.Phase)
+			problems = append(problems, "Can't have a negative phase of "+testcase.Metadata.Negative.Phase)
 		}
 	}
 
 	if testcase.HasFlag(RawFlag) {
 		if testcase.HasFlag(StrictFlag) || testcase.HasFlag(NonStrictFlag) {
-			panic("Invalid testcase. Can't be raw and strict or nonStrict")
+			problems = append(problems, "Can't be raw and strict or nonStrict")
 		}
 
 		if len(testcase.Metadata.Includes) > 0 {
-			panic("Invalid testcase. Can't be raw and have includes")
-
+			problems = append(problems, "Can't be raw and have includes")
 		}
 	}
+
+	return problems
 }
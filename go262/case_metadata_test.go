@@ -0,0 +1,173 @@
+/*
+ * Copyright (c) 2017 Crimson AS <info@crimson.no>
+ * Author: Robin Burchell <robin.burchell@crimson.no>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package go262
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestScanFrontmatter(t *testing.T) {
+	tests := []struct {
+		name       string
+		src        string
+		yaml       string
+		line       int
+		dataOffset int
+		errLine    int
+	}{
+		{"none", "foo();\n", "", 0, 0, 0},
+		{"empty", "", "", 0, 0, 0},
+		{"first", "/*---\ndescription: x\n---*/\nfoo();\n", "\ndescription: x\n", 1, 27, 0},
+		{"crlf", "/*---\r\ndescription: x\r\n---*/\r\nfoo();\r\n", "\ndescription: x\n", 1, 30, 0},
+		{"bom", "\ufeff/*---\ndescription: x\n---*/\n", "\ndescription: x\n", 1, 30, 0},
+		{"line comment header", "// Copyright\n// License\n\n/*---\ndescription: x\n---*/\nfoo();\n", "\ndescription: x\n", 4, 52, 0},
+		{"block comment header", "/*\n * Copyright\n */\n/*---\ndescription: x\n---*/\n", "\ndescription: x\n", 4, 47, 0},
+		{"crlf block comment header", "/*\r\n * Copyright\r\n */\r\n/*---\r\ndescription: x\r\n---*/\r\n", "\ndescription: x\n", 4, 53, 0},
+		{"hashbang", "#!/usr/bin/env node\n/*---\ndescription: x\n---*/\n", "\ndescription: x\n", 2, 47, 0},
+		// The data is the whole file when code comes before the block
+		{"not first", "foo();\n/*---\ndescription: x\n---*/\n", "\ndescription: x\n", 2, 0, 0},
+		{"not first crlf", "foo();\r\nbar();\r\n/*---\r\ndescription: x\r\n---*/\r\n", "\ndescription: x\n", 3, 0, 0},
+		{"not on own line", "foo(); /*---\ndescription: x\n---*/\n", "", 0, 0, 0},
+		{"unterminated", "// Copyright\n/*---\ndescription: x\n", "", 0, 0, 2},
+		{"unterminated not first", "foo();\n\n/*---\ndescription: x\n", "", 0, 0, 3},
+		{"unterminated comment", "// Copyright\n\n/* Copyright\n/*---\n", "", 0, 0, 3},
+	}
+
+	for _, test := range tests {
+		fm, err := scanFrontmatter(test.src)
+		if test.errLine > 0 {
+			ferr, ok := err.(*FrontmatterError)
+			if !ok || ferr.Line != test.errLine {
+				t.Errorf("%s: got error %v, want one on line %d", test.name, err, test.errLine)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", test.name, err)
+			continue
+		}
+		if len(test.yaml) == 0 {
+			if fm != nil {
+				t.Errorf("%s: found frontmatter %q, want none", test.name, fm.yaml)
+			}
+			continue
+		}
+		if fm == nil {
+			t.Errorf("%s: found no frontmatter", test.name)
+			continue
+		}
+		if fm.yaml != test.yaml || fm.line != test.line || fm.dataOffset != test.dataOffset {
+			t.Errorf("%s: got %q on line %d, data at %d; want %q on line %d, data at %d", test.name, fm.yaml, fm.line, fm.dataOffset, test.yaml, test.line, test.dataOffset)
+		}
+	}
+}
+
+func TestDuplicateKeys(t *testing.T) {
+	tests := []struct {
+		yaml string
+		dups string
+	}{
+		{"description: a\nflags: [raw]\n", ""},
+		{"description: a\ndescription: b\n", "description"},
+		{"negative:\n  phase: parse\n  type: SyntaxError\n  type: TypeError\n", "negative.type"},
+		{"flags: [raw]\nnegative:\n  phase: parse\nflags: [module]\nnegative:\n  type: SyntaxError\n", "flags,negative"},
+	}
+
+	for _, test := range tests {
+		dups, err := duplicateKeys(test.yaml)
+		if err != nil {
+			t.Errorf("%q: unexpected error %v", test.yaml, err)
+		} else if strings.Join(dups, ",") != test.dups {
+			t.Errorf("%q: got duplicates %v, want %s", test.yaml, dups, test.dups)
+		}
+	}
+}
+
+func TestParseMetadataErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		src     string
+		errLine int
+	}{
+		{"ok", "// Copyright\r\n/*---\r\ndescription: x\r\nflags: [onlyStrict]\r\n---*/\r\n", 0},
+		{"duplicate key", "// Copyright\n/*---\ndescription: a\nflags: [raw]\ndescription: b\n---*/\n", 5},
+		{"duplicate nested key", "/*---\nnegative:\n  phase: parse\n  type: SyntaxError\n  type: TypeError\n---*/\n", 1},
+		{"unterminated", "/*---\ndescription: x\n", 1},
+		{"bad yaml", "// Copyright\n/*---\ndescription: x\nflags: [raw\n---*/\n", 4},
+		{"invalid", "/*---\nnegative:\n  phase: runtime\n---*/\n", 1},
+	}
+
+	for _, test := range tests {
+		testcase := &TestCase{}
+		err := testcase.ParseMetadata(test.src)
+		if test.errLine == 0 {
+			if err != nil {
+				t.Errorf("%s: unexpected error %v", test.name, err)
+			}
+			continue
+		}
+		ferr, ok := err.(*FrontmatterError)
+		if !ok || ferr.Line != test.errLine {
+			t.Errorf("%s: got error %v, want one on line %d", test.name, err, test.errLine)
+		}
+	}
+}
+
+func FuzzScanFrontmatter(f *testing.F) {
+	f.Add("/*---\ndescription: x\n---*/\nfoo();\n")
+	f.Add("// Copyright\r\n/*---\r\ndescription: x\r\n---*/\r\n")
+	f.Add("/* Copyright */\n/*---\nnegative:\n  phase: parse\n  type: SyntaxError\n---*/\n")
+	f.Add("foo();\n/*---\ndescription: x\n---*/\n")
+	f.Add("/*---\ndescription: x\n")
+	f.Add("/* unterminated")
+	f.Add("\ufeff#!/usr/bin/env node\n/*---\nflags: [raw\n---*/\n")
+
+	f.Fuzz(func(t *testing.T, src string) {
+		fm, err := scanFrontmatter(src)
+		if err != nil {
+			if _, ok := err.(*FrontmatterError); !ok {
+				t.Fatalf("error %v isn't a FrontmatterError", err)
+			}
+			if fm != nil {
+				t.Fatalf("got both frontmatter and error %v", err)
+			}
+		} else if fm != nil {
+			if fm.line < 1 || fm.line > 1+strings.Count(src, "\n") {
+				t.Fatalf("frontmatter on line %d of a %d line file", fm.line, 1+strings.Count(src, "\n"))
+			}
+			if fm.dataOffset < 0 || fm.dataOffset > len(src) {
+				t.Fatalf("data offset %d out of range", fm.dataOffset)
+			}
+		}
+
+		// Parsing the metadata only fails with errors pointing at a line
+		testcase := &TestCase{}
+		if err := testcase.ParseMetadata(src); err != nil {
+			if _, ok := err.(*FrontmatterError); !ok {
+				t.Fatalf("ParseMetadata error %v isn't a FrontmatterError", err)
+			}
+		}
+	})
+}
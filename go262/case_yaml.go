@@ -24,16 +24,60 @@
 package go262
 
 import (
+	"fmt"
 	yaml "gopkg.in/yaml.v2"
 	"strings"
 )
 
-func load(text string) (error, TestMetadata) {
+// Returns the keys that are defined more than once in text, as a dotted path
+// (e.g. negative.type).
+func duplicateKeys(text string) ([]string, error) {
+	doc := yaml.MapSlice{}
+	if err := yaml.Unmarshal([]byte(text), &doc); err != nil {
+		return nil, err
+	}
+
+	var dups []string
+	var check func(prefix string, m yaml.MapSlice)
+	check = func(prefix string, m yaml.MapSlice) {
+		seen := make(map[interface{}]bool)
+		for _, item := range m {
+			key := prefix + fmt.Sprint(item.Key)
+			if seen[item.Key] {
+				dups = append(dups, key)
+			}
+			seen[item.Key] = true
+			if child, ok := item.Value.(yaml.MapSlice); ok {
+				check(key+".", child)
+			}
+		}
+	}
+	check("", doc)
+	return dups, nil
+}
+
+// Parse harness/features.yml, keeping the order of its entries.
+func loadFeatureIncludes(text string) ([]featureInclude, error) {
+	doc := yaml.MapSlice{}
+	if err := yaml.Unmarshal([]byte(text), &doc); err != nil {
+		return nil, err
+	}
+
+	var result []featureInclude
+	for _, item := range doc {
+		fi := featureInclude{fmt.Sprint(item.Key), nil}
+		features, _ := item.Value.([]interface{})
+		for _, feature := range features {
+			fi.features = append(fi.features, fmt.Sprint(feature))
+		}
+		result = append(result, fi)
+	}
+	return result, nil
+}
+
+func load(text string) (TestMetadata, error) {
 	metadata := TestMetadata{}
 	err := yaml.Unmarshal([]byte(text), &metadata)
 	metadata.Description = strings.TrimSpace(metadata.Description)
-	if err != nil {
-		panic("Error " + err.Error())
-	}
-	return nil, metadata
+	return metadata, err
 }
@@ -0,0 +1,286 @@
+/*
+ * Copyright (c) 2017 Crimson AS <info@crimson.no>
+ * Author: Robin Burchell <robin.burchell@crimson.no>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package go262
+
+// All editions we report on, oldest first. ESNext covers proposals, and any
+// feature tag we don't know about. Tests that can't be dated come last, under
+// UndatedEdition.
+var Editions = []string{
+	"ES5",
+	"ES2015",
+	"ES2016",
+	"ES2017",
+	"ES2018",
+	"ES2019",
+	"ES2020",
+	"ES2021",
+	"ES2022",
+	"ES2023",
+	"ES2024",
+	"ESNext",
+	UndatedEdition,
+}
+
+const unknownEdition = "ESNext"
+
+// The edition of tests that give no hint of when what they cover was added
+const UndatedEdition = "Unknown"
+
+// The edition that introduced each feature tag (see test262's features.txt)
+var featureEditions = map[string]string{
+	// ES2015
+	"ArrayBuffer":                   "ES2015",
+	"Array.prototype.values":        "ES2015",
+	"DataView":                      "ES2015",
+	"DataView.prototype.getFloat32": "ES2015",
+	"DataView.prototype.getFloat64": "ES2015",
+	"DataView.prototype.getInt16":   "ES2015",
+	"DataView.prototype.getInt32":   "ES2015",
+	"DataView.prototype.getInt8":    "ES2015",
+	"DataView.prototype.getUint16":  "ES2015",
+	"DataView.prototype.getUint32":  "ES2015",
+	"DataView.prototype.setUint8":   "ES2015",
+	"Float32Array":                  "ES2015",
+	"Float64Array":                  "ES2015",
+	"Int16Array":                    "ES2015",
+	"Int32Array":                    "ES2015",
+	"Int8Array":                     "ES2015",
+	"Map":                           "ES2015",
+	"Promise":                       "ES2015",
+	"Proxy":                         "ES2015",
+	"Reflect":                       "ES2015",
+	"Reflect.construct":             "ES2015",
+	"Reflect.set":                   "ES2015",
+	"Reflect.setPrototypeOf":        "ES2015",
+	"Set":                           "ES2015",
+	"String.fromCodePoint":          "ES2015",
+	"String.prototype.endsWith":     "ES2015",
+	"String.prototype.includes":     "ES2015",
+	"Symbol":                        "ES2015",
+	"Symbol.hasInstance":            "ES2015",
+	"Symbol.isConcatSpreadable":     "ES2015",
+	"Symbol.iterator":               "ES2015",
+	"Symbol.match":                  "ES2015",
+	"Symbol.replace":                "ES2015",
+	"Symbol.search":                 "ES2015",
+	"Symbol.species":                "ES2015",
+	"Symbol.split":                  "ES2015",
+	"Symbol.toPrimitive":            "ES2015",
+	"Symbol.toStringTag":            "ES2015",
+	"Symbol.unscopables":            "ES2015",
+	"TypedArray":                    "ES2015",
+	"Uint16Array":                   "ES2015",
+	"Uint32Array":                   "ES2015",
+	"Uint8Array":                    "ES2015",
+	"Uint8ClampedArray":             "ES2015",
+	"WeakMap":                       "ES2015",
+	"WeakSet":                       "ES2015",
+	"arrow-function":                "ES2015",
+	"class":                         "ES2015",
+	"computed-property-names":       "ES2015",
+	"const":                         "ES2015",
+	"cross-realm":                   "ES2015",
+	"default-parameters":            "ES2015",
+	"destructuring-assignment":      "ES2015",
+	"destructuring-binding":         "ES2015",
+	"for-of":                        "ES2015",
+	"generators":                    "ES2015",
+	"let":                           "ES2015",
+	"new.target":                    "ES2015",
+	"proxy-missing-checks":          "ES2015",
+	"rest-parameters":               "ES2015",
+	"spread":                        "ES2015",
+	"super":                         "ES2015",
+	"tail-call-optimization":        "ES2015",
+	"template":                      "ES2015",
+	"u180e":                         "ES2015",
+
+	// ES2016
+	"Array.prototype.includes": "ES2016",
+	"exponentiation":           "ES2016",
+
+	// ES2017
+	"Atomics":           "ES2017",
+	"SharedArrayBuffer": "ES2017",
+	"async-functions":   "ES2017",
+
+	// ES2018
+	"Promise.prototype.finally":       "ES2018",
+	"Symbol.asyncIterator":            "ES2018",
+	"async-iteration":                 "ES2018",
+	"object-rest":                     "ES2018",
+	"object-spread":                   "ES2018",
+	"regexp-dotall":                   "ES2018",
+	"regexp-lookbehind":               "ES2018",
+	"regexp-named-groups":             "ES2018",
+	"regexp-unicode-property-escapes": "ES2018",
+
+	// ES2019
+	"Array.prototype.flat":         "ES2019",
+	"Array.prototype.flatMap":      "ES2019",
+	"Object.fromEntries":           "ES2019",
+	"String.prototype.trimEnd":     "ES2019",
+	"String.prototype.trimStart":   "ES2019",
+	"Symbol.prototype.description": "ES2019",
+	"json-superset":                "ES2019",
+	"optional-catch-binding":       "ES2019",
+	"stable-array-sort":            "ES2019",
+	"string-trimming":              "ES2019",
+	"well-formed-json-stringify":   "ES2019",
+
+	// ES2020
+	"BigInt":                               "ES2020",
+	"Promise.allSettled":                   "ES2020",
+	"String.prototype.matchAll":            "ES2020",
+	"Symbol.matchAll":                      "ES2020",
+	"coalesce-expression":                  "ES2020",
+	"dynamic-import":                       "ES2020",
+	"export-star-as-namespace-from-module": "ES2020",
+	"for-in-order":                         "ES2020",
+	"globalThis":                           "ES2020",
+	"import.meta":                          "ES2020",
+	"optional-chaining":                    "ES2020",
+
+	// ES2021
+	"AggregateError":               "ES2021",
+	"FinalizationRegistry":         "ES2021",
+	"Promise.any":                  "ES2021",
+	"String.prototype.replaceAll":  "ES2021",
+	"WeakRef":                      "ES2021",
+	"logical-assignment-operators": "ES2021",
+	"numeric-separator-literal":    "ES2021",
+
+	// ES2022
+	"Array.prototype.at":           "ES2022",
+	"Object.hasOwn":                "ES2022",
+	"String.prototype.at":          "ES2022",
+	"TypedArray.prototype.at":      "ES2022",
+	"class-fields-private":         "ES2022",
+	"class-fields-private-in":      "ES2022",
+	"class-fields-public":          "ES2022",
+	"class-methods-private":        "ES2022",
+	"class-static-block":           "ES2022",
+	"class-static-fields-private":  "ES2022",
+	"class-static-fields-public":   "ES2022",
+	"class-static-methods-private": "ES2022",
+	"error-cause":                  "ES2022",
+	"regexp-match-indices":         "ES2022",
+	"top-level-await":              "ES2022",
+
+	// ES2023
+	"array-find-from-last":    "ES2023",
+	"change-array-by-copy":    "ES2023",
+	"hashbang":                "ES2023",
+	"symbols-as-weakmap-keys": "ES2023",
+
+	// ES2024
+	"Atomics.waitAsync":             "ES2024",
+	"String.prototype.isWellFormed": "ES2024",
+	"String.prototype.toWellFormed": "ES2024",
+	"array-grouping":                "ES2024",
+	"arraybuffer-transfer":          "ES2024",
+	"promise-with-resolvers":        "ES2024",
+	"regexp-v-flag":                 "ES2024",
+	"resizable-arraybuffer":         "ES2024",
+}
+
+func editionIndex(edition string) int {
+	for i, e := range Editions {
+		if e == edition {
+			return i
+		}
+	}
+	return len(Editions) - 1
+}
+
+// Returns the edition that introduced what this test covers.
+//
+// The newest edition of any of the test's features wins. Tests without any
+// features cover ES5 if they have an es5id, and ES2015 if they have an es6id,
+// as test262 doesn't tag features that were already in ES2015. Others (e.g.
+// with only an esid, which many later tests written before feature tags
+// have) can't be dated.
+func (testcase *TestCase) Edition() string {
+	edition := ""
+	for _, feature := range testcase.Metadata.Features {
+		e, ok := featureEditions[feature]
+		if !ok {
+			e = unknownEdition
+		}
+		if edition == "" || editionIndex(e) > editionIndex(edition) {
+			edition = e
+		}
+	}
+
+	if edition != "" {
+		return edition
+	}
+
+	if len(testcase.Metadata.Es5Id) > 0 {
+		return "ES5"
+	} else if len(testcase.Metadata.Es6Id) > 0 {
+		return "ES2015"
+	}
+
+	return UndatedEdition
+}
+
+// Results for all tests introduced by a given edition
+type EditionResults struct {
+	// e.g. ES2017
+	Edition string
+
+	// How many tests cover this edition
+	TestCount int
+
+	// Results for the tests of this edition
+	SuiteResults
+
+	// Results for the tests of this edition, and all the earlier ones. This
+	// answers whether we support "all of ES2017".
+	CumulativeResults SuiteResults
+}
+
+// Get results aggregated by edition, oldest first.
+func (global *GlobalState) CalculateEditionResults() []*EditionResults {
+	var results []*EditionResults
+	for _, edition := range Editions {
+		results = append(results, &EditionResults{edition, 0, newSuiteResults(), newSuiteResults()})
+	}
+
+	for _, test := range global.testMap {
+		idx := editionIndex(test.Edition())
+		results[idx].TestCount++
+		results[idx].addTest(test)
+		for i := idx; i < len(results); i++ {
+			// Undated tests are part of no edition but their own
+			if i > idx && results[i].Edition == UndatedEdition {
+				break
+			}
+			results[i].CumulativeResults.addTest(test)
+		}
+	}
+
+	return results
+}
@@ -0,0 +1,59 @@
+/*
+ * Copyright (c) 2017 Crimson AS <info@crimson.no>
+ * Author: Robin Burchell <robin.burchell@crimson.no>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package go262
+
+import (
+	"testing"
+)
+
+func TestEdition(t *testing.T) {
+	tests := []struct {
+		features []string
+		esId     string
+		es6Id    string
+		es5Id    string
+		edition  string
+	}{
+		{nil, "", "", "15.4.4.14", "ES5"},
+		{nil, "", "22.1.3.11", "", "ES2015"},
+		{nil, "sec-array.prototype.indexof", "22.1.3.11", "15.4.4.14", "ES5"},
+		{nil, "sec-array.prototype.includes", "", "", UndatedEdition},
+		{nil, "", "", "", UndatedEdition},
+		{[]string{"Symbol"}, "sec-foo", "", "", "ES2015"},
+		{[]string{"Symbol", "exponentiation"}, "sec-foo", "", "", "ES2016"},
+		{[]string{"Atomics"}, "", "", "15.1", "ES2017"},
+		{[]string{"not-a-known-feature"}, "sec-foo", "", "", "ESNext"},
+	}
+
+	for _, test := range tests {
+		testcase := &TestCase{}
+		testcase.Metadata.Features = test.features
+		testcase.Metadata.EsId = test.esId
+		testcase.Metadata.Es6Id = test.es6Id
+		testcase.Metadata.Es5Id = test.es5Id
+		if got := testcase.Edition(); got != test.edition {
+			t.Errorf("%v esid %q es6id %q es5id %q: Edition() = %q, want %q", test.features, test.esId, test.es6Id, test.es5Id, got, test.edition)
+		}
+	}
+}
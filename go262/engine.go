@@ -0,0 +1,413 @@
+/*
+ * Copyright (c) 2017 Crimson AS <info@crimson.no>
+ * Author: Robin Burchell <robin.burchell@crimson.no>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package go262
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	yaml "gopkg.in/yaml.v2"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The default pattern used to find an uncaught exception in an engine's stderr.
+// It matches lines like "TypeError: foo", "Uncaught TypeError: foo",
+// "Uncaught exception: TypeError: foo" or "/tmp/test.js:12: TypeError: foo",
+// but not an error name merely mentioned in the middle of a logged line.
+const DefaultErrorPattern = `(?m)^(?:Uncaught(?: exception)?:?[ \t]+|\S+:\d+:[ \t]+)?([A-Za-z_$][\w$]*(?:Error|Exception)):[ \t]?(.*?)\r?$`
+
+// An Engine describes the JavaScript executable tests are run with, and how to
+// make sense of its output.
+type Engine struct {
+	// A name to tell engines apart, e.g. qmljs-jit
+	Name string
+
+	// The full path to the executable
+	Path string
+
+	// Extra arguments passed before the test file
+	Args []string
+
+	// Arguments that make the engine print its version (if it can)
+	VersionArgs []string
+
+	// Directories to find includes in before the test262 harness directory,
+	// in order. This way host shims and extra harness files can be provided
+	// without touching the test262 checkout.
+	IncludeDirs []string
+
+	// Files loaded before the harness for every test, in order (e.g. a print
+	// polyfill)
+	Preludes []string
+
+	// How the $262 host object is provided: NativeHost262 if the engine has
+	// it, the path of a shim to load before the harness otherwise, or
+	// NoHost262 if there is none. If empty, it isn't known, and tests using
+	// $262 are run anyway.
+	Host262 string
+
+	// The $262 capabilities the engine provides (e.g. createRealm, gc).
+	// If nil, all of them are assumed to work.
+	HostCapabilities []string
+
+	// The path of a shim implementing $262.agent with the engine's workers,
+	// loaded after the $262 shim. Without one, only engines with a native
+	// $262 can provide agents.
+	AgentShim string
+
+	// The path of a hook starting the engine's workers, on which go262 builds
+	// $262.agent itself (see agent_protocol.go), instead of an AgentShim
+	AgentHook string
+
+	// Whether the main thread can block (e.g. in Atomics.wait) by default,
+	// and the extra arguments that make it able to, or unable to, for tests
+	// that want otherwise. Nil arguments mean it can't be changed.
+	MainCanBlock    bool
+	CanBlockArgs    []string
+	CannotBlockArgs []string
+
+	// Whether the engine takes several script files, running them one after
+	// the other in the same realm. The harness is then given as a script of
+	// its own, and doesn't offset the line numbers of the test.
+	SeparateScripts bool
+
+	// Extra arguments that start the engine as a persistent host, running
+	// many tests in one process (see hostRequest). Nil to start a process
+	// per test.
+	HostArgs []string
+
+	// How long a persistent host may take over a test before it is
+	// restarted (DefaultHostTimeout if 0)
+	HostTimeout time.Duration
+
+	// Other configurations to run every test in too (see EngineVariant).
+	// Those with arguments don't use persistent hosts (see usesHost).
+	Variants []EngineVariant
+
+	// Idle persistent hosts. Access under hostLock.
+	hosts    []*engineHost
+	hostLock sync.Mutex
+
+	// Finds the uncaught exception in stderr. The first submatch is the
+	// constructor name of the thrown value, the second is its message.
+	errorPattern *regexp.Regexp
+
+	// The hash of the executable and arguments, and the modification time of
+	// the executable it was calculated for. Access these under hashLock.
+	hash        string
+	hashModTime time.Time
+	hashLock    sync.Mutex
+}
+
+// Create an Engine for the executable at pathName, using DefaultErrorPattern to
+// find uncaught exceptions.
+func NewEngine(pathName string, args ...string) *Engine {
+	return &Engine{
+		Name:         path.Base(pathName),
+		Path:         pathName,
+		Args:         args,
+		errorPattern: regexp.MustCompile(DefaultErrorPattern),
+	}
+}
+
+// How engines are described in an engine profile file
+type engineConfig struct {
+	Name         string
+	Path         string
+	Args         []string
+	VersionArgs  []string `yaml:"versionArgs"`
+	ErrorPattern string   `yaml:"errorPattern"`
+	IncludeDirs  []string `yaml:"includeDirs"`
+	Preludes     []string
+
+	Host262          string   `yaml:"host262"`
+	HostCapabilities []string `yaml:"hostCapabilities"`
+
+	AgentShim       string   `yaml:"agentShim"`
+	AgentHook       string   `yaml:"agentHook"`
+	MainCanBlock    bool     `yaml:"mainCanBlock"`
+	CanBlockArgs    []string `yaml:"canBlockArgs"`
+	CannotBlockArgs []string `yaml:"cannotBlockArgs"`
+
+	SeparateScripts bool `yaml:"separateScripts"`
+
+	HostArgs    []string `yaml:"hostArgs"`
+	HostTimeout string   `yaml:"hostTimeout"`
+
+	Variants []EngineVariant
+}
+
+// Load engine profiles from a YAML file, holding a list of engines like:
+//
+//   - name: qmljs
+//     path: /path/to/qmljs
+//     args: [--some-flag]
+//     versionArgs: [--version]
+//     errorPattern: "^Uncaught exception: (\\w+): (.*)$"
+//     includeDirs: [shims/qmljs]
+//     preludes: [shims/qmljs/print.js]
+//     host262: shims/qmljs/262.js
+//     hostCapabilities: [createRealm, evalScript, detachArrayBuffer, gc]
+//     agentShim: shims/qmljs/agent.js
+//     agentHook: shims/qmljs/agent-hook.js
+//     mainCanBlock: false
+//     canBlockArgs: [--main-can-block]
+//     separateScripts: true
+//     hostArgs: [shims/qmljs/host.js]
+//     hostTimeout: 30s
+//     variants: [{name: no-jit, args: [--no-jit]}]
+//
+// Only path is required.
+func LoadEngines(fileName string) ([]*Engine, error) {
+	buf, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+
+	var configs []engineConfig
+	if err := yaml.Unmarshal(buf, &configs); err != nil {
+		return nil, errors.New(fileName + ": " + err.Error())
+	}
+
+	var engines []*Engine
+	for _, config := range configs {
+		if len(config.Path) == 0 {
+			return nil, errors.New(fileName + ": engine " + config.Name + " has no path")
+		}
+		engine := NewEngine(config.Path, config.Args...)
+		if len(config.Name) > 0 {
+			engine.Name = config.Name
+		}
+		engine.VersionArgs = config.VersionArgs
+		engine.IncludeDirs = config.IncludeDirs
+		engine.Preludes = config.Preludes
+		engine.Host262 = config.Host262
+		engine.HostCapabilities = config.HostCapabilities
+		engine.AgentShim = config.AgentShim
+		engine.AgentHook = config.AgentHook
+		engine.MainCanBlock = config.MainCanBlock
+		engine.CanBlockArgs = config.CanBlockArgs
+		engine.CannotBlockArgs = config.CannotBlockArgs
+		engine.SeparateScripts = config.SeparateScripts
+		engine.HostArgs = config.HostArgs
+		if len(config.HostTimeout) > 0 {
+			engine.HostTimeout, err = time.ParseDuration(config.HostTimeout)
+			if err != nil {
+				return nil, errors.New(fileName + ": engine " + engine.Name + ": " + err.Error())
+			}
+		}
+		for _, variant := range config.Variants {
+			if err := checkVariantName(variant.Name); err != nil {
+				return nil, errors.New(fileName + ": engine " + engine.Name + ": " + err.Error())
+			}
+		}
+		engine.Variants = config.Variants
+		if len(config.ErrorPattern) > 0 {
+			if err := engine.SetErrorPattern(config.ErrorPattern); err != nil {
+				return nil, errors.New(fileName + ": engine " + engine.Name + ": " + err.Error())
+			}
+		}
+		engines = append(engines, engine)
+	}
+	return engines, nil
+}
+
+// Set the pattern used to find uncaught exceptions. It must have exactly two
+// submatches: the constructor name, and the message.
+func (engine *Engine) SetErrorPattern(pattern string) error {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return err
+	}
+	if re.NumSubexp() != 2 {
+		return errors.New("error pattern must have two submatches: " + pattern)
+	}
+	engine.errorPattern = re
+	return nil
+}
+
+// Extract the constructor name and message of the uncaught exception from a
+// run's stderr output. Both are empty if nothing was thrown. The engine
+// reports the exception as the run ends, so anything matching earlier on (e.g.
+// logged by the test) is ignored in favour of the last match.
+func (engine *Engine) ParseUncaughtError(stderr string) (string, string) {
+	matches := engine.errorPattern.FindAllStringSubmatch(stderr, -1)
+	if matches == nil {
+		return "", ""
+	}
+	last := matches[len(matches)-1]
+	return last[1], last[2]
+}
+
+// Returns a description of the engine build, for recording alongside results.
+// This is the output of running it with VersionArgs if set, and the
+// modification time of the executable otherwise.
+func (engine *Engine) Version() string {
+	if len(engine.VersionArgs) > 0 {
+		out, err := exec.Command(engine.Path, engine.VersionArgs...).CombinedOutput()
+		if err == nil {
+			return strings.TrimSpace(string(out))
+		}
+	}
+
+	info, err := os.Stat(engine.Path)
+	if err != nil {
+		return "unknown"
+	}
+	return "built " + info.ModTime().Format(time.RFC3339)
+}
+
+// Returns a hash of the executable's contents, the arguments it is run with,
+// its $262 capabilities, and its blocking and host options, so results can be
+// reused while none of them change. Variants are left out, see runTypeHash.
+// It is only recalculated when the executable is modified.
+func (engine *Engine) Hash() string {
+	engine.hashLock.Lock()
+	defer engine.hashLock.Unlock()
+
+	info, err := os.Stat(engine.Path)
+	if err != nil {
+		return ""
+	}
+	if len(engine.hash) > 0 && info.ModTime().Equal(engine.hashModTime) {
+		return engine.hash
+	}
+
+	f, err := os.Open(engine.Path)
+	if err != nil {
+		log.Printf("Can't hash engine %s: %s", engine.Path, err.Error())
+		return ""
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		log.Printf("Can't hash engine %s: %s", engine.Path, err.Error())
+		return ""
+	}
+	for _, arg := range engine.Args {
+		h.Write([]byte{0})
+		h.Write([]byte(arg))
+	}
+
+	// What $262 provides decides which tests can run at all
+	h.Write([]byte{1})
+	h.Write([]byte(engine.Host262))
+	for _, capability := range engine.HostCapabilities {
+		h.Write([]byte{0})
+		h.Write([]byte(capability))
+	}
+
+	// As do the ways the main thread can be made to block
+	if engine.MainCanBlock {
+		h.Write([]byte{2})
+	} else {
+		h.Write([]byte{3})
+	}
+	for _, args := range [][]string{engine.CanBlockArgs, engine.CannotBlockArgs, engine.HostArgs} {
+		h.Write([]byte{1})
+		for _, arg := range args {
+			h.Write([]byte{0})
+			h.Write([]byte(arg))
+		}
+	}
+
+	engine.hash = hex.EncodeToString(h.Sum(nil))
+	engine.hashModTime = info.ModTime()
+	return engine.hash
+}
+
+// Write source to a temporary file, returning its name. Remove it when done.
+func writeTempScript(source string) string {
+	tmpfile, err := ioutil.TempFile("", "example")
+	if err != nil {
+		panic("can't get tempfile! " + err.Error())
+	}
+	if _, err := tmpfile.Write([]byte(source)); err != nil {
+		panic("can't write tmpfile! " + err.Error())
+	}
+	if err := tmpfile.Close(); err != nil {
+		panic("can't close tmpfile! " + err.Error())
+	}
+	return tmpfile.Name()
+}
+
+// Runs the code in a fresh engine process with args, and returns whether it
+// exited successfully, with its stdout and stderr. Positions in stderr are
+// rewritten to the files the code came from. If the engine can't be started,
+// the code fails, with the error in stderr.
+func (engine *Engine) runProcess(args []string, src *jobSource) (bool, string, string) {
+	args = append([]string{}, args...)
+	preludeName := ""
+	if src.prelude != nil {
+		preludeName = writeTempScript(src.prelude.source)
+		defer os.Remove(preludeName)
+		args = append(args, preludeName)
+	}
+	testName := writeTempScript(src.test.source)
+	defer os.Remove(testName)
+
+	cmd := exec.Command(engine.Path, append(args, testName)...)
+	var stdout bytes.Buffer
+	var stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+
+	if err != nil {
+		if _, ok := err.(*exec.ExitError); !ok {
+			// The engine couldn't be started, e.g. it is being rebuilt
+			log.Printf("Can't run %s: %s", engine.Name, err)
+			return false, "", "go262: can't run engine: " + err.Error() + "\n"
+		}
+	}
+
+	return err == nil, stdout.String(), src.rewrite(stderr.String(), preludeName, testName)
+}
+
+// Set the engine tests are run with. If its harness files can't be read, the
+// engine isn't changed, and the error is returned.
+func (global *GlobalState) SetEngine(engine *Engine) error {
+	old := global.engine
+	global.engine = engine
+	if err := global.readIncludeCaches(); err != nil {
+		global.engine = old
+		return err
+	}
+	return nil
+}
+
+func (global *GlobalState) Engine() *Engine {
+	return global.engine
+}
@@ -0,0 +1,245 @@
+/*
+ * Copyright (c) 2017 Crimson AS <info@crimson.no>
+ * Author: Robin Burchell <robin.burchell@crimson.no>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package go262
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// How long a persistent host may take over a test before it is restarted, if
+// the engine doesn't say
+const DefaultHostTimeout = time.Minute
+
+// Persistent hosts run many tests in one engine process, saving the process
+// start-up for each test. The engine is started with its Args and HostArgs
+// (typically the path of a host script), and then talks over its stdin and
+// stdout, one JSON object per line. For every test, go262 writes:
+//
+//	{"source": "...", "fileName": "go262-test.js"}
+//
+// With SeparateScripts, the harness is sent separately too:
+//
+//	{"prelude": "...", "preludeFileName": "go262-prelude.js", "source": ...}
+//
+// The host runs the prelude and then the source in a fresh realm, giving them
+// the file names in positions it reports, and answers with:
+//
+//	{"success": true, "stdout": "...", "stderr": "..."}
+//
+// where success is false if the test threw, and stderr holds the uncaught
+// exception as the engine would have printed it (see ParseUncaughtError).
+// Only the stderr in the answer belongs to the test. What the host writes to
+// its own stderr is thrown away, unless the host dies or times out, when what
+// it wrote since the request was sent is shown instead.
+type hostRequest struct {
+	Prelude         string `json:"prelude,omitempty"`
+	PreludeFileName string `json:"preludeFileName,omitempty"`
+	Source          string `json:"source"`
+	FileName        string `json:"fileName"`
+}
+
+// The names scripts are given in persistent hosts
+const hostPreludeFileName = "go262-prelude.js"
+const hostTestFileName = "go262-test.js"
+
+type hostResponse struct {
+	Success bool   `json:"success"`
+	Stdout  string `json:"stdout"`
+	Stderr  string `json:"stderr"`
+}
+
+// A bytes.Buffer that can be written from another goroutine
+type syncBuffer struct {
+	buf  bytes.Buffer
+	lock sync.Mutex
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.buf.Write(p)
+}
+
+// Returns what was written since the last call.
+func (b *syncBuffer) take() string {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	s := b.buf.String()
+	b.buf.Reset()
+	return s
+}
+
+// A running persistent host process
+type engineHost struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout *bufio.Reader
+	stderr *syncBuffer
+
+	// The engine hash it was started with, so hosts of an old build are
+	// not reused
+	engineHash string
+}
+
+func (engine *Engine) startHost() (*engineHost, error) {
+	args := append(append([]string{}, engine.Args...), engine.HostArgs...)
+	cmd := exec.Command(engine.Path, args...)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	stderr := &syncBuffer{}
+	cmd.Stderr = stderr
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	return &engineHost{cmd, stdin, bufio.NewReader(stdout), stderr, engine.Hash()}, nil
+}
+
+// Stop the host, for good.
+func (host *engineHost) kill() {
+	host.stdin.Close()
+	host.cmd.Process.Kill()
+	host.cmd.Wait()
+}
+
+// Sends the code to the host, and waits for the answer. An error means the host
+// is unusable, and must be killed.
+func (host *engineHost) run(src *jobSource, timeout time.Duration) (*hostResponse, error) {
+	request := &hostRequest{"", "", src.test.source, hostTestFileName}
+	if src.prelude != nil {
+		request.Prelude = src.prelude.source
+		request.PreludeFileName = hostPreludeFileName
+	}
+	buf, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+	// Whatever was written after the last answer doesn't belong to this test
+	host.stderr.take()
+	if _, err := host.stdin.Write(append(buf, '\n')); err != nil {
+		return nil, errors.New("host went away: " + err.Error())
+	}
+
+	type answer struct {
+		response *hostResponse
+		err      error
+	}
+	answers := make(chan answer, 1)
+	go func() {
+		line, err := host.stdout.ReadBytes('\n')
+		if err != nil {
+			answers <- answer{nil, errors.New("host went away: " + err.Error())}
+			return
+		}
+		response := &hostResponse{}
+		if err := json.Unmarshal(line, response); err != nil {
+			answers <- answer{nil, errors.New("host sent a bad answer: " + err.Error())}
+			return
+		}
+		answers <- answer{response, nil}
+	}()
+
+	select {
+	case a := <-answers:
+		if a.err != nil {
+			return nil, a.err
+		}
+		return a.response, nil
+	case <-time.After(timeout):
+		// Killing the host ends the read above
+		return nil, errors.New("timed out after " + timeout.String())
+	}
+}
+
+// Whether a job run with args goes to a persistent host. Hosts are all started
+// with the engine's own Args, and a request can't change how the engine runs,
+// so jobs needing more arguments get a process of their own: those of
+// variants with arguments, and those the main thread must (or mustn't) be able
+// to block in (see argsFor). Variants are deliberately not given hosts of
+// their own, which would keep a set of idle processes per variant.
+func (engine *Engine) usesHost(args []string) bool {
+	return engine.HostArgs != nil && len(args) == len(engine.Args)
+}
+
+// Runs the code in one of the engine's persistent hosts, starting one if none
+// is free, and returns whether it succeeded, with its stdout and stderr. A
+// host that crashes or times out is thrown away, and the test fails, as it
+// does when no host can be started.
+func (engine *Engine) runInHost(src *jobSource) (bool, string, string) {
+	engineHash := engine.Hash()
+
+	var host *engineHost
+	engine.hostLock.Lock()
+	for len(engine.hosts) > 0 && host == nil {
+		host = engine.hosts[len(engine.hosts)-1]
+		engine.hosts = engine.hosts[:len(engine.hosts)-1]
+		if host.engineHash != engineHash {
+			// The engine was rebuilt since
+			go host.kill()
+			host = nil
+		}
+	}
+	engine.hostLock.Unlock()
+
+	if host == nil {
+		var err error
+		host, err = engine.startHost()
+		if err != nil {
+			log.Printf("Can't start %s host: %s", engine.Name, err)
+			return false, "", "go262: can't start host: " + err.Error() + "\n"
+		}
+	}
+
+	timeout := engine.HostTimeout
+	if timeout == 0 {
+		timeout = DefaultHostTimeout
+	}
+
+	response, err := host.run(src, timeout)
+	if err != nil {
+		host.kill()
+		log.Printf("Restarting %s host: %s", engine.Name, err.Error())
+		return false, "", host.stderr.take() + "go262: " + err.Error() + "\n"
+	}
+
+	engine.hostLock.Lock()
+	engine.hosts = append(engine.hosts, host)
+	engine.hostLock.Unlock()
+
+	return response.Success, response.Stdout, src.rewrite(response.Stderr, hostPreludeFileName, hostTestFileName)
+}
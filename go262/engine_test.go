@@ -0,0 +1,119 @@
+/*
+ * Copyright (c) 2017 Crimson AS <info@crimson.no>
+ * Author: Robin Burchell <robin.burchell@crimson.no>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package go262
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestParseUncaughtError(t *testing.T) {
+	tests := []struct {
+		stderr  string
+		errType string
+		message string
+	}{
+		{"", "", ""},
+		{"TypeError: foo\n", "TypeError", "foo"},
+		{"TypeError: foo\r\n", "TypeError", "foo"},
+		{"Uncaught TypeError: foo", "TypeError", "foo"},
+		{"Uncaught exception: Test262Error: Expected true\n", "Test262Error", "Expected true"},
+		{"/tmp/test.js:12: SyntaxError: Unexpected token\n", "SyntaxError", "Unexpected token"},
+		{"/tmp/x.js:5\n    throw new Test262Error('foo');\n    ^\n\nTest262Error: foo\n    at Object.<anonymous> (/tmp/x.js:5:11)\n", "Test262Error", "foo"},
+		// Error names merely mentioned in the log aren't what was thrown
+		{"checking that a TypeError: is thrown\n", "", ""},
+		{"log: SyntaxError: expected\n", "", ""},
+		// The engine reports the uncaught exception last
+		{"SyntaxError: logged earlier\nTypeError: thrown\n", "TypeError", "thrown"},
+		{"ReferenceError:\n", "ReferenceError", ""},
+	}
+
+	engine := NewEngine("/bin/true")
+	for _, test := range tests {
+		errType, message := engine.ParseUncaughtError(test.stderr)
+		if errType != test.errType || message != test.message {
+			t.Errorf("ParseUncaughtError(%q) = %q, %q; want %q, %q", test.stderr, errType, message, test.errType, test.message)
+		}
+	}
+}
+
+func TestIsSuccessfulNegative(t *testing.T) {
+	tests := []struct {
+		phase     string
+		negType   string
+		success   bool
+		errorType string
+		want      bool
+	}{
+		{"", "", true, "", true},
+		{"", "", false, "TypeError", false},
+		{ParsePhase, "SyntaxError", false, "SyntaxError", true},
+		{ParsePhase, "SyntaxError", true, "", false},
+		{ParsePhase, "SyntaxError", false, "Test262Error", false},
+		{RuntimePhase, "TypeError", false, "TypeError", true},
+		// The type must match exactly, not just be an error
+		{RuntimePhase, "TypeError", false, "RangeError", false},
+		{RuntimePhase, "TypeError", false, "", false},
+	}
+
+	for _, test := range tests {
+		testcase := &TestCase{}
+		testcase.Metadata.Negative.Phase = test.phase
+		testcase.Metadata.Negative.Type = test.negType
+		result := &TestResult{TestJob: &TestJob{testcase, "strict"}, success: test.success, ErrorType: test.errorType}
+		if got := result.IsSuccessful(); got != test.want {
+			t.Errorf("negative %q %q, success %v, threw %q: IsSuccessful() = %v, want %v", test.phase, test.negType, test.success, test.errorType, got, test.want)
+		}
+	}
+}
+
+func TestRunTypeHash(t *testing.T) {
+	f, err := ioutil.TempFile("", "engine")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	defer os.Remove(f.Name())
+
+	engine := NewEngine(f.Name())
+	engine.Variants = []EngineVariant{{"a", []string{"--a"}}, {"b", []string{"--b"}}}
+	hashes := make(map[string]string)
+	for _, runType := range engine.RunTypes() {
+		hashes[runType] = engine.runTypeHash(runType)
+	}
+	if hashes["strict"] != engine.Hash() || hashes["strict:a"] == hashes["strict"] || hashes["strict:a"] == hashes["strict:b"] {
+		t.Fatalf("Unexpected hashes %v", hashes)
+	}
+
+	// Changing a variant only changes its own hash
+	engine.Variants[1].Args = []string{"--c"}
+	engine.Variants = append(engine.Variants, EngineVariant{"d", nil})
+	for runType, hash := range hashes {
+		_, name := SplitRunType(runType)
+		if changed := engine.runTypeHash(runType) != hash; changed != (name == "b") {
+			t.Errorf("%s: changed is %v", runType, changed)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+/*
+ * Copyright (c) 2017 Crimson AS <info@crimson.no>
+ * Author: Robin Burchell <robin.burchell@crimson.no>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package go262
+
+import (
+	"sort"
+)
+
+// Results for all tests tagged with a given feature
+type FeatureResults struct {
+	// The feature tag, e.g. BigInt
+	Feature string
+
+	// How many tests are tagged with this feature
+	TestCount int
+
+	SuiteResults
+}
+
+type featureSorter []*FeatureResults
+
+func (a featureSorter) Len() int      { return len(a) }
+func (a featureSorter) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
+func (a featureSorter) Less(i, j int) bool {
+	return a[i].Feature < a[j].Feature
+}
+
+// Get results aggregated by feature tag, sorted by feature name.
+func (global *GlobalState) CalculateFeatureResults() []*FeatureResults {
+	features := make(map[string]*FeatureResults)
+
+	for _, test := range global.testMap {
+		for _, feature := range test.Metadata.Features {
+			r := features[feature]
+			if r == nil {
+				r = &FeatureResults{feature, 0, newSuiteResults()}
+				features[feature] = r
+			}
+			r.TestCount++
+			r.addTest(test)
+		}
+	}
+
+	var results []*FeatureResults
+	for _, r := range features {
+		results = append(results, r)
+	}
+	sort.Sort(featureSorter(results))
+	return results
+}
@@ -29,38 +29,430 @@ import (
 	"log"
 	"os"
 	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
 )
 
-func (global *GlobalState) fetchFromIncludeCache(file string) (error, string) {
-	if len(global.includeCache[file]) == 0 {
-		return errors.New("Can't fetch include " + file), ""
+// Harness files that are loaded before every test (that isn't raw)
+var standardIncludes = []string{"sta.js", "cth.js", "assert.js"}
+
+// A harness file that tests can include
+type harnessInclude struct {
+	// The path of the file, relative to the include directory
+	name string
+
+	// The file it was read from
+	pathName string
+
+	source string
+
+	// Other includes this one needs, from its frontmatter
+	dependencies []string
+
+	// The $262 capabilities it uses
+	hostCapabilities []string
+}
+
+// An entry of harness/features.yml: an include, and the features a test must
+// have for it to be included automatically
+type featureInclude struct {
+	name     string
+	features []string
+}
+
+// All harness includes of a test262 checkout, layered with those of the
+// engine. This doesn't change once read; a rescan reads a new one.
+type harnessIncludes struct {
+	// The engine's prelude files, in order
+	preludes []*harnessInclude
+
+	// Relative path -> include
+	includes map[string]*harnessInclude
+
+	// File name -> relative path, for includes given by their name only.
+	// Empty if the name is ambiguous.
+	baseNames map[string]string
+
+	// From harness/features.yml, in order
+	featureIncludes []featureInclude
+
+	// Harness code built from the includes (see harnessPrelude).
+	// Resolved include names -> code
+	builtPreludes map[string]*sourceBuilder
+
+	// Lock access to builtPreludes
+	preludeLock sync.Mutex
+}
+
+// Read the harness includes of the test262 checkout at rootPath, and those in
+// the engine's include directories, which take precedence. The engine's
+// prelude files are read too.
+func readHarnessIncludes(rootPath string, engine *Engine) (*harnessIncludes, error) {
+	h := &harnessIncludes{
+		nil,
+		make(map[string]*harnessInclude),
+		make(map[string]string),
+		nil,
+		make(map[string]*sourceBuilder),
+		sync.Mutex{},
+	}
+
+	for _, pathName := range engine.Preludes {
+		bytes, err := ioutil.ReadFile(pathName)
+		if err != nil {
+			return nil, errors.New("Can't read prelude " + pathName + ": " + err.Error())
+		}
+		_, name := path.Split(pathName)
+		h.preludes = append(h.preludes, &harnessInclude{name, pathName, string(bytes), nil, nil})
+	}
+
+	// A $262 shim goes after the preludes, which it may use
+	if len(engine.Host262) > 0 && engine.Host262 != NativeHost262 && engine.Host262 != NoHost262 {
+		bytes, err := ioutil.ReadFile(engine.Host262)
+		if err != nil {
+			return nil, errors.New("Can't read $262 shim " + engine.Host262 + ": " + err.Error())
+		}
+		_, name := path.Split(engine.Host262)
+		h.preludes = append(h.preludes, &harnessInclude{name, engine.Host262, string(bytes), nil, nil})
 	}
-	return nil, global.includeCache[file]
+
+	// And the $262.agent shim after that, which extends $262, or the agent
+	// hook and go262's own $262.agent on top of it
+	if len(engine.AgentShim) > 0 && len(engine.AgentHook) > 0 {
+		return nil, errors.New("An engine can't have both a $262.agent shim and an agent hook")
+	}
+	if len(engine.AgentHook) > 0 {
+		bytes, err := ioutil.ReadFile(engine.AgentHook)
+		if err != nil {
+			return nil, errors.New("Can't read agent hook " + engine.AgentHook + ": " + err.Error())
+		}
+		_, name := path.Split(engine.AgentHook)
+		h.preludes = append(h.preludes, &harnessInclude{name, engine.AgentHook, string(bytes), nil, nil})
+		h.preludes = append(h.preludes, &harnessInclude{agentProtocolName, agentProtocolName, agentProtocolSource, nil, nil})
+	}
+	if len(engine.AgentShim) > 0 {
+		bytes, err := ioutil.ReadFile(engine.AgentShim)
+		if err != nil {
+			return nil, errors.New("Can't read $262.agent shim " + engine.AgentShim + ": " + err.Error())
+		}
+		_, name := path.Split(engine.AgentShim)
+		h.preludes = append(h.preludes, &harnessInclude{name, engine.AgentShim, string(bytes), nil, nil})
+	}
+
+	// Walk the lowest layer first, so the others replace what it has
+	harnessDir := rootPath + "/harness"
+	if err := h.readIncludeDir(harnessDir); err != nil {
+		return nil, err
+	}
+	for i := len(engine.IncludeDirs) - 1; i >= 0; i-- {
+		if err := h.readIncludeDir(engine.IncludeDirs[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	if bytes, err := ioutil.ReadFile(harnessDir + "/features.yml"); err == nil {
+		h.featureIncludes, err = loadFeatureIncludes(string(bytes))
+		if err != nil {
+			log.Printf("Invalid %s/features.yml: %s", harnessDir, err.Error())
+		}
+	}
+
+	return h, nil
 }
 
-func (global *GlobalState) walkHarnessIncludes(pathName string, info os.FileInfo, err error) error {
-	_, name := path.Split(pathName)
+// Read all includes under pathName, replacing any with the same name.
+func (h *harnessIncludes) readIncludeDir(pathName string) error {
+	return filepath.Walk(pathName, func(filePath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return errors.New("Can't walk harness " + filePath + ": " + err.Error())
+		}
+
+		if info.IsDir() || !strings.HasSuffix(filePath, ".js") {
+			return nil
+		}
+
+		bytes, err := ioutil.ReadFile(filePath)
+		if err != nil {
+			return errors.New("Can't read harness file " + filePath + ": " + err.Error())
+		}
+
+		name, _ := filepath.Rel(pathName, filePath)
+		name = filepath.ToSlash(name)
+		inc := &harnessInclude{name, filePath, string(bytes), nil, findHostCapabilities(string(bytes))}
+
+		if fm, err := scanFrontmatter(inc.source); err != nil {
+			log.Printf("Invalid harness file %s: %s", filePath, err.Error())
+		} else if fm != nil {
+			meta, err := load(fm.yaml)
+			if err != nil {
+				log.Printf("Invalid harness file %s: %s", filePath, yamlError(fm, err).Error())
+			}
+			inc.dependencies = meta.Includes
+		}
+
+		_, baseName := path.Split(name)
+		if other, ok := h.baseNames[baseName]; ok && other != name {
+			h.baseNames[baseName] = ""
+		} else if !ok {
+			h.baseNames[baseName] = name
+		}
 
-	if info.IsDir() {
+		h.includes[name] = inc
 		return nil
+	})
+}
+
+// Find an include by its path relative to the harness directory, or by its
+// file name if that is unique.
+func (h *harnessIncludes) lookup(name string) *harnessInclude {
+	if inc := h.includes[path.Clean(name)]; inc != nil {
+		return inc
 	}
+	if _, baseName := path.Split(name); baseName == name {
+		return h.includes[h.baseNames[baseName]]
+	}
+	return nil
+}
 
-	bytes, err := ioutil.ReadFile(pathName)
-	if err != nil {
-		log.Fatalf("Can't read file! %s: %s", pathName, err.Error())
+// Returns the includes a test with the given features and includes needs, in
+// the order they must be loaded: those for its features (see features.yml),
+// and then its own, each preceded by their dependencies. Every include
+// appears once, and the standard includes are left out, as they are always
+// loaded first.
+func (h *harnessIncludes) resolve(features []string, includes []string) ([]string, error) {
+	var resolved []string
+	seen := make(map[string]bool)
+	for _, name := range standardIncludes {
+		seen[name] = true
+	}
+
+	var visit func(name string, from string) error
+	visit = func(name string, from string) error {
+		inc := h.lookup(name)
+		if inc == nil {
+			if len(from) > 0 {
+				return errors.New("Can't fetch include " + name + " (needed by " + from + ")")
+			}
+			return errors.New("Can't fetch include " + name)
+		}
+		if seen[inc.name] {
+			return nil
+		}
+		seen[inc.name] = true
+
+		for _, dep := range inc.dependencies {
+			if err := visit(dep, inc.name); err != nil {
+				return err
+			}
+		}
+		resolved = append(resolved, inc.name)
+		return nil
 	}
 
-	global.includeCache[name] = string(bytes)
+	hasFeature := func(feature string) bool {
+		for _, f := range features {
+			if f == feature {
+				return true
+			}
+		}
+		return false
+	}
+
+	for _, fi := range h.featureIncludes {
+		wanted := len(fi.features) > 0
+		for _, feature := range fi.features {
+			wanted = wanted && hasFeature(feature)
+		}
+		if wanted {
+			if err := visit(fi.name, "features.yml"); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	for _, name := range includes {
+		if err := visit(name, ""); err != nil {
+			return nil, err
+		}
+	}
+
+	return resolved, nil
+}
+
+// Returns the harness includes of the engine tests are run with.
+func (global *GlobalState) harnessIncludes() *harnessIncludes {
+	return global.harnessIncludesFor(global.engine)
+}
+
+func (global *GlobalState) harnessIncludesFor(engine *Engine) *harnessIncludes {
+	global.includeLock.RLock()
+	defer global.includeLock.RUnlock()
+	return global.includeCaches[engine]
+}
+
+// Returns the source of a harness include, prelude or shim of any engine,
+// given the file it was read from (see ResolvedInclude.PathName).
+func (global *GlobalState) HarnessSource(pathName string) (string, bool) {
+	global.includeLock.RLock()
+	defer global.includeLock.RUnlock()
+
+	for _, h := range global.includeCaches {
+		for _, inc := range h.preludes {
+			if inc.pathName == pathName {
+				return inc.source, true
+			}
+		}
+		for _, inc := range h.includes {
+			if inc.pathName == pathName {
+				return inc.source, true
+			}
+		}
+	}
+	return "", false
+}
+
+// (Re)read the harness includes of every engine in use. If any can't be read,
+// the ones read before are kept, and the error is returned.
+func (global *GlobalState) readIncludeCaches() error {
+	caches := make(map[*Engine]*harnessIncludes)
+	for _, engine := range global.Engines() {
+		h, err := readHarnessIncludes(global.rootPath, engine)
+		if err != nil {
+			return err
+		}
+		caches[engine] = h
+	}
+
+	global.includeLock.Lock()
+	global.includeCaches = caches
+	global.includeLock.Unlock()
 	return nil
 }
 
-func init() {
+func (global *GlobalState) fetchFromIncludeCache(file string) (error, string) {
+	inc := global.harnessIncludes().lookup(file)
+	if inc == nil || len(inc.source) == 0 {
+		return errors.New("Can't fetch include " + file), ""
+	}
+	return nil, inc.source
+}
+
+// An include as it is loaded before a test
+type ResolvedInclude struct {
+	// The name it is included by
+	Name string
+
+	// The file it was read from
+	PathName string
+}
+
+// Returns everything loaded before this test, in order: the engine's
+// preludes and $262 shims, the standard harness files, and the includes the
+// test needs, with their dependencies and anything harness/features.yml adds
+// for its features.
+func (testcase *TestCase) ResolveIncludes() ([]ResolvedInclude, error) {
+	h := testcase.global.harnessIncludes()
+	names, err := h.resolve(testcase.Metadata.Features, testcase.Metadata.Includes)
+	if err != nil {
+		return nil, err
+	}
+
+	var resolved []ResolvedInclude
+	for _, inc := range h.preludes {
+		resolved = append(resolved, ResolvedInclude{inc.name, inc.pathName})
+	}
+	for _, name := range standardIncludes {
+		if inc := h.lookup(name); inc != nil {
+			resolved = append(resolved, ResolvedInclude{inc.name, inc.pathName})
+		}
+	}
+	for _, name := range names {
+		resolved = append(resolved, ResolvedInclude{name, h.lookup(name).pathName})
+	}
+	return resolved, nil
+}
+
+// Returns the harness code to put before a test run with engine: its preludes
+// and $262 shims, the standard harness files, and everything it includes.
+// These are built once per set of includes, and shared between all tests
+// using that set.
+func (testcase *TestCase) harnessPrelude(engine *Engine) *sourceBuilder {
+	h := testcase.global.harnessIncludesFor(engine)
+
+	// No need to check for errors at this point. verifyIncludes should have
+	// already caught any problem.
+	includes, _ := h.resolve(testcase.Metadata.Features, testcase.Metadata.Includes)
+	key := strings.Join(includes, "\x00")
+
+	h.preludeLock.Lock()
+	prelude, ok := h.builtPreludes[key]
+	h.preludeLock.Unlock()
+	if ok {
+		return prelude
+	}
+
+	prelude = &sourceBuilder{}
+	for _, inc := range h.preludes {
+		prelude.add(inc.source, inc.pathName, 1)
+	}
+
+	for _, name := range standardIncludes {
+		if inc := h.lookup(name); inc != nil {
+			prelude.add(inc.source, inc.pathName, 1)
+		}
+	}
+
+	// Specific test includes
+	for _, name := range includes {
+		inc := h.lookup(name)
+		prelude.add(inc.source, inc.pathName, 1)
+	}
+
+	h.preludeLock.Lock()
+	h.builtPreludes[key] = prelude
+	h.preludeLock.Unlock()
+	return prelude
 }
 
+// Check that everything the test includes, with their dependencies and the
+// includes harness/features.yml adds, can be found with every engine's
+// harness, marking the test as broken otherwise (see IncludeError).
 func (testcase *TestCase) verifyIncludes() {
-	for _, s := range testcase.Metadata.Includes {
-		if err, _ := testcase.global.fetchFromIncludeCache(s); err != nil {
-			log.Fatalf("Cannot find include %s\n", s)
+	var err error
+	for _, engine := range testcase.global.Engines() {
+		h := testcase.global.harnessIncludesFor(engine)
+		if _, err = h.resolve(testcase.Metadata.Features, testcase.Metadata.Includes); err != nil {
+			if engine != testcase.global.engine {
+				err = errors.New(err.Error() + " with engine " + engine.Name)
+			}
+			log.Printf("%s: %s", testcase.PathName, err.Error())
+			break
 		}
 	}
+
+	testcase.caseLock.Lock()
+	testcase.includeError = err
+	testcase.caseLock.Unlock()
+}
+
+// Returns the tests whose includes can't be resolved, sorted by path.
+func (global *GlobalState) BrokenTests() []*TestCase {
+	var broken []*TestCase
+	for _, test := range global.testMap {
+		if test.IncludeError() != nil {
+			broken = append(broken, test)
+		}
+	}
+	sort.Sort(testSorter(broken))
+	return broken
+}
+
+// Returns why the test's includes can't be resolved, if they can't. Such a
+// test is broken, and fails without running until it is fixed.
+func (testcase *TestCase) IncludeError() error {
+	testcase.caseLock.Lock()
+	defer testcase.caseLock.Unlock()
+	return testcase.includeError
 }
@@ -0,0 +1,453 @@
+/*
+ * Copyright (c) 2017 Crimson AS <info@crimson.no>
+ * Author: Robin Burchell <robin.burchell@crimson.no>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package go262
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Where runs are recorded, one JSON file per run
+const historyDir = "TestHistory"
+
+// How many of the latest runs are kept in memory, for flakiness scores and
+// trends. Of older runs, only the last outcome of each job is kept.
+const HistoryWindow = 50
+
+// The outcome of a single TestJob in a recorded run
+type HistoryResult struct {
+	Success           bool
+	ErrorType         string `json:",omitempty"`
+	ExecutionDuration time.Duration
+
+	// How many times the job was run, and whether the outcomes disagreed
+	Attempts int  `json:",omitempty"`
+	Flaky    bool `json:",omitempty"`
+
+	// What is needed to restore the result (see restoreLastResults)
+	ExitSuccess  bool
+	ErrorMessage string `json:",omitempty"`
+	SourceHash   string `json:",omitempty"`
+	EngineHash   string `json:",omitempty"`
+
+	// What the engine lacked, if the test couldn't run
+	Unsupported []string `json:",omitempty"`
+}
+
+// A recorded run of a set of jobs
+type HistoryRun struct {
+	// When the run started
+	Date time.Time
+
+	// The engine the run was performed with
+	EnginePath    string
+	EngineVersion string
+
+	// PathName -> RunType -> outcome
+	// Beware, this is filled from a different thread while the run is in
+	// progress. Ensure you access it under runLock.
+	Results map[string]map[string]*HistoryResult
+
+	// The same for the other engines jobs were run with (see AddEngine),
+	// by engine name
+	EngineResults map[string]map[string]map[string]*HistoryResult `json:",omitempty"`
+
+	runLock sync.Mutex
+}
+
+type historyState struct {
+	// The latest recorded runs (at most HistoryWindow), oldest first
+	runs []*HistoryRun
+
+	// The last outcome of each job before the oldest of runs, by path and
+	// run type
+	before map[string]map[string]*HistoryResult
+
+	// The last results of other engines, by engine name, path and run type,
+	// read from the history until the engine is added
+	engineResults map[string]map[string]map[string]*HistoryResult
+
+	// Lock access to runs, before and engineResults
+	historyLock sync.Mutex
+}
+
+// Add a run to the latest ones, folding the oldest into before once there are
+// more than HistoryWindow.
+func (history *historyState) addRun(run *HistoryRun) {
+	history.historyLock.Lock()
+	defer history.historyLock.Unlock()
+
+	history.runs = append(history.runs, run)
+	if len(history.runs) <= HistoryWindow {
+		return
+	}
+
+	if history.before == nil {
+		history.before = make(map[string]map[string]*HistoryResult)
+	}
+	for _, old := range history.runs[:len(history.runs)-HistoryWindow] {
+		old.runLock.Lock()
+		for pathName, results := range old.Results {
+			for runType, result := range results {
+				addHistoryResult(history.before, pathName, runType, result)
+			}
+		}
+		old.runLock.Unlock()
+	}
+	history.runs = append([]*HistoryRun{}, history.runs[len(history.runs)-HistoryWindow:]...)
+}
+
+// Start recording a new run. Record results to it, and then finish it with
+// FinishRun.
+func (global *GlobalState) StartRun() *HistoryRun {
+	return &HistoryRun{
+		Date:          time.Now(),
+		EnginePath:    global.engine.Path,
+		EngineVersion: global.engine.Version(),
+		Results:       make(map[string]map[string]*HistoryResult),
+		EngineResults: make(map[string]map[string]map[string]*HistoryResult),
+	}
+}
+
+func newHistoryResult(result *TestResult) *HistoryResult {
+	return &HistoryResult{
+		result.IsSuccessful(),
+		result.ErrorType,
+		result.ExecutionDuration,
+		len(result.Attempts),
+		result.Flaky,
+		result.success,
+		result.ErrorMessage,
+		result.SourceHash,
+		result.EngineHash,
+		result.Unsupported,
+	}
+}
+
+// Returns the result a recorded outcome of a job stands for. Output logs
+// aren't recorded, so they are lost.
+func (result *HistoryResult) testResult(job *TestJob) *TestResult {
+	return &TestResult{
+		job,
+		result.ExitSuccess,
+		"",
+		"",
+		result.ExecutionDuration,
+		result.ErrorType,
+		result.ErrorMessage,
+		nil,
+		result.Flaky,
+		result.SourceHash,
+		result.EngineHash,
+		result.Unsupported,
+	}
+}
+
+// Record the result of a job in this run, along with the last results of the
+// other engines for it.
+func (run *HistoryRun) Record(result *TestResult) {
+	test := result.TestCase
+	others := make(map[string]*HistoryResult)
+	for _, engine := range test.global.others {
+		if res := test.GetResultWith(engine, result.RunType); res != nil {
+			others[engine.Name] = newHistoryResult(res)
+		}
+	}
+
+	run.runLock.Lock()
+	defer run.runLock.Unlock()
+
+	addHistoryResult(run.Results, test.PathName, result.RunType, newHistoryResult(result))
+	for name, res := range others {
+		if run.EngineResults[name] == nil {
+			run.EngineResults[name] = make(map[string]map[string]*HistoryResult)
+		}
+		addHistoryResult(run.EngineResults[name], test.PathName, result.RunType, res)
+	}
+}
+
+func addHistoryResult(results map[string]map[string]*HistoryResult, pathName string, runType string, result *HistoryResult) {
+	if results[pathName] == nil {
+		results[pathName] = make(map[string]*HistoryResult)
+	}
+	results[pathName][runType] = result
+}
+
+// Returns the outcome of a test for a run type in this run, or nil if it
+// wasn't part of the run.
+func (run *HistoryRun) ResultFor(pathName string, runType string) *HistoryResult {
+	run.runLock.Lock()
+	defer run.runLock.Unlock()
+	return run.Results[pathName][runType]
+}
+
+// Add a finished run to the history, and save it. Runs that didn't record
+// anything (e.g. cancelled straight away) are dropped.
+func (global *GlobalState) FinishRun(run *HistoryRun) {
+	run.runLock.Lock()
+	empty := len(run.Results) == 0
+	run.runLock.Unlock()
+	if empty {
+		return
+	}
+
+	global.history.addRun(run)
+	global.writeHistoryRun(run)
+}
+
+// Returns the latest recorded runs (at most HistoryWindow), oldest first.
+func (global *GlobalState) History() []*HistoryRun {
+	global.history.historyLock.Lock()
+	defer global.history.historyLock.Unlock()
+	return append([]*HistoryRun{}, global.history.runs...)
+}
+
+func (global *GlobalState) writeHistoryRun(run *HistoryRun) {
+	if err := os.MkdirAll(historyDir, 0755); err != nil {
+		log.Printf("Can't create history directory: %s", err.Error())
+		return
+	}
+
+	run.runLock.Lock()
+	buf, err := json.Marshal(run)
+	run.runLock.Unlock()
+	if err != nil {
+		panic("Can't encode run: " + err.Error())
+	}
+
+	fileName := path.Join(historyDir, run.Date.UTC().Format("20060102T150405.000000000")+".json")
+	if err := ioutil.WriteFile(fileName, buf, 0644); err != nil {
+		log.Printf("Can't write history %s: %s", fileName, err.Error())
+	}
+}
+
+// Read a recorded run, or return nil if it can't be read.
+func readHistoryRun(fileName string) *HistoryRun {
+	buf, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		log.Printf("Can't read history %s: %s", fileName, err.Error())
+		return nil
+	}
+	run := &HistoryRun{}
+	if err := json.Unmarshal(buf, run); err != nil {
+		log.Printf("Can't parse history %s: %s", fileName, err.Error())
+		return nil
+	}
+	return run
+}
+
+// Read the recorded runs, restoring the last results of tests from them. Only
+// the latest HistoryWindow runs are kept; older ones are read one at a time,
+// and folded into the last outcomes before them (see addRun).
+func (global *GlobalState) readHistory() {
+	files, err := ioutil.ReadDir(historyDir)
+	if err != nil {
+		log.Printf("Can't read history (this might be OK): %s", err)
+		return
+	}
+
+	// Files are named by date, and sorted by name
+	var fileNames []string
+	for _, info := range files {
+		if info.IsDir() || !strings.HasSuffix(info.Name(), ".json") {
+			continue
+		}
+		fileNames = append(fileNames, path.Join(historyDir, info.Name()))
+	}
+
+	for _, fileName := range fileNames {
+		run := readHistoryRun(fileName)
+		if run == nil {
+			continue
+		}
+		global.restoreLastResults(run)
+		global.history.addRun(run)
+	}
+}
+
+// Restore the last result of every test in a run, so unchanged jobs needn't be
+// rerun after a restart. Runs must be restored oldest first. The results of
+// other engines are kept until the engine is added (see restoreEngineResults).
+func (global *GlobalState) restoreLastResults(run *HistoryRun) {
+	for pathName, results := range run.Results {
+		test := global.testMap[pathName]
+		if test == nil {
+			continue
+		}
+		for runType, result := range results {
+			test.setLastResult(result.testResult(&TestJob{test, runType}))
+		}
+	}
+
+	global.history.historyLock.Lock()
+	defer global.history.historyLock.Unlock()
+	if global.history.engineResults == nil {
+		global.history.engineResults = make(map[string]map[string]map[string]*HistoryResult)
+	}
+	for name, engineResults := range run.EngineResults {
+		if global.history.engineResults[name] == nil {
+			global.history.engineResults[name] = make(map[string]map[string]*HistoryResult)
+		}
+		for pathName, results := range engineResults {
+			for runType, result := range results {
+				addHistoryResult(global.history.engineResults[name], pathName, runType, result)
+			}
+		}
+	}
+}
+
+// Restore the last results of an engine besides the main one, read from the
+// history before it was added.
+func (global *GlobalState) restoreEngineResults(engine *Engine) {
+	global.history.historyLock.Lock()
+	engineResults := global.history.engineResults[engine.Name]
+	delete(global.history.engineResults, engine.Name)
+	global.history.historyLock.Unlock()
+
+	for pathName, results := range engineResults {
+		test := global.testMap[pathName]
+		if test == nil {
+			continue
+		}
+		for runType, result := range results {
+			test.setResultWith(engine, result.testResult(&TestJob{test, runType}))
+		}
+	}
+}
+
+// Returns how flaky a test is for a run type: the fraction of the latest
+// recorded runs including it in which it was flaky, between 0 and 1.
+func (global *GlobalState) FlakinessScore(pathName string, runType string) float64 {
+	runs := 0.0
+	flaky := 0.0
+	for _, run := range global.History() {
+		result := run.ResultFor(pathName, runType)
+		if result == nil {
+			continue
+		}
+		runs += 1
+		if result.Flaky {
+			flaky += 1
+		}
+	}
+
+	if runs == 0 {
+		return 0
+	}
+	return flaky / runs
+}
+
+// The pass rate of a suite in a recorded run
+type SuiteHistoryPoint struct {
+	Run *HistoryRun
+
+	// Total tests for a type that had run by the end of the run
+	TotalCounts map[string]float64
+
+	// Total tests for a type whose last outcome by the end of the run was
+	// successful
+	SuccessCounts map[string]float64
+}
+
+// Counts of the last outcome of each job of a suite
+type suiteTally struct {
+	last          map[string]map[string]*HistoryResult
+	totalCounts   map[string]float64
+	successCounts map[string]float64
+}
+
+// Make result the last outcome of a job, replacing the one before.
+func (tally *suiteTally) add(pathName string, runType string, result *HistoryResult) {
+	for i, r := range []*HistoryResult{tally.last[pathName][runType], result} {
+		if r == nil || len(r.Unsupported) > 0 {
+			continue
+		}
+		sign := 1.0
+		if i == 0 {
+			sign = -1
+		}
+		tally.totalCounts[runType] += sign
+		if r.Success {
+			tally.successCounts[runType] += sign
+		}
+	}
+	addHistoryResult(tally.last, pathName, runType, result)
+}
+
+// Returns the pass rate of this suite (and all suites under it) after each of
+// the latest recorded runs that ran any of its tests, oldest first. Runs often
+// only run some of the tests (e.g. those that changed), so each point counts
+// the last outcome of every test by the end of that run.
+func (suite *TestSuite) History() []*SuiteHistoryPoint {
+	var points []*SuiteHistoryPoint
+	prefix := suite.PathName + "/"
+	tally := &suiteTally{make(map[string]map[string]*HistoryResult), make(map[string]float64), make(map[string]float64)}
+	inSuite := func(pathName string) bool {
+		return strings.HasPrefix(pathName, prefix) && suite.global.testMap[pathName] != nil
+	}
+
+	global := suite.global
+	global.history.historyLock.Lock()
+	runs := append([]*HistoryRun{}, global.history.runs...)
+	for pathName, results := range global.history.before {
+		if inSuite(pathName) {
+			for runType, result := range results {
+				tally.add(pathName, runType, result)
+			}
+		}
+	}
+	global.history.historyLock.Unlock()
+
+	for _, run := range runs {
+		ran := false
+		run.runLock.Lock()
+		for pathName, results := range run.Results {
+			if !inSuite(pathName) {
+				continue
+			}
+			for runType, result := range results {
+				tally.add(pathName, runType, result)
+				ran = true
+			}
+		}
+		run.runLock.Unlock()
+
+		if ran {
+			p := &SuiteHistoryPoint{run, make(map[string]float64), make(map[string]float64)}
+			for runType, count := range tally.totalCounts {
+				p.TotalCounts[runType] = count
+				p.SuccessCounts[runType] = tally.successCounts[runType]
+			}
+			points = append(points, p)
+		}
+	}
+
+	return points
+}
@@ -0,0 +1,75 @@
+/*
+ * Copyright (c) 2017 Crimson AS <info@crimson.no>
+ * Author: Robin Burchell <robin.burchell@crimson.no>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package go262
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestSuiteHistoryPartialRuns(t *testing.T) {
+	global := newGlobalState("test262")
+	suite := &TestSuite{"test262/test/a", nil, nil, global}
+	for i := 0; i < 10; i++ {
+		global.testMap[fmt.Sprintf("test262/test/a/%d.js", i)] = &TestCase{}
+	}
+
+	// A full run where every test passes, then one running only the two
+	// tests that changed, which now fail
+	full := &HistoryRun{Date: time.Now(), Results: make(map[string]map[string]*HistoryResult)}
+	for pathName := range global.testMap {
+		addHistoryResult(full.Results, pathName, "strict", &HistoryResult{Success: true})
+	}
+	partial := &HistoryRun{Date: time.Now(), Results: make(map[string]map[string]*HistoryResult)}
+	addHistoryResult(partial.Results, "test262/test/a/1.js", "strict", &HistoryResult{Success: false})
+	addHistoryResult(partial.Results, "test262/test/a/2.js", "strict", &HistoryResult{Success: false})
+	// Tests of other suites, or that are gone, don't count
+	addHistoryResult(partial.Results, "test262/test/b/1.js", "strict", &HistoryResult{Success: false})
+	addHistoryResult(partial.Results, "test262/test/a/gone.js", "strict", &HistoryResult{Success: false})
+	global.history.addRun(full)
+	global.history.addRun(partial)
+
+	points := suite.History()
+	if len(points) != 2 {
+		t.Fatalf("Got %d points, want 2", len(points))
+	}
+	for i, want := range []float64{10, 8} {
+		if points[i].TotalCounts["strict"] != 10 || points[i].SuccessCounts["strict"] != want {
+			t.Errorf("Point %d: %v of %v passed, want %v of 10", i, points[i].SuccessCounts["strict"], points[i].TotalCounts["strict"], want)
+		}
+	}
+
+	// Once the full run is older than the window, it still counts
+	for i := 0; i < HistoryWindow; i++ {
+		run := &HistoryRun{Date: time.Now(), Results: make(map[string]map[string]*HistoryResult)}
+		addHistoryResult(run.Results, "test262/test/a/3.js", "strict", &HistoryResult{Success: i%2 == 0})
+		global.history.addRun(run)
+	}
+	points = suite.History()
+	last := points[len(points)-1]
+	if len(points) != HistoryWindow || last.TotalCounts["strict"] != 10 || last.SuccessCounts["strict"] != 7 {
+		t.Errorf("Got %d points, the last with %v of %v passed, want %d points, 7 of 10", len(points), last.SuccessCounts["strict"], last.TotalCounts["strict"], HistoryWindow)
+	}
+}
@@ -0,0 +1,190 @@
+/*
+ * Copyright (c) 2017 Crimson AS <info@crimson.no>
+ * Author: Robin Burchell <robin.burchell@crimson.no>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package go262
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Set as an engine's Host262 when the engine provides $262 itself
+const NativeHost262 = "native"
+
+// Set as an engine's Host262 when the engine has no $262 at all
+const NoHost262 = "none"
+
+// Finds uses of the $262 host object's capabilities, like $262.createRealm
+var hostCapabilityRegexp = regexp.MustCompile(`\$262\.(\w+)`)
+
+// Returns source without its comments. String and template literals are kept
+// as they are, as they may be evaluated.
+func stripComments(source string) string {
+	var buf strings.Builder
+	for i := 0; i < len(source); i++ {
+		c := source[i]
+		switch {
+		case c == '"' || c == '\'' || c == '`':
+			// Copy the literal up to its (unescaped) end
+			j := i + 1
+			for j < len(source) && source[j] != c {
+				if source[j] == '\\' {
+					j++
+				} else if source[j] == '\n' && c != '`' {
+					break
+				}
+				j++
+			}
+			if j >= len(source) {
+				j = len(source) - 1
+			}
+			buf.WriteString(source[i : j+1])
+			i = j
+		case strings.HasPrefix(source[i:], "//"):
+			end := strings.IndexByte(source[i:], '\n')
+			if end < 0 {
+				return buf.String()
+			}
+			i += end - 1
+		case strings.HasPrefix(source[i:], "/*"):
+			end := strings.Index(source[i+2:], "*/")
+			if end < 0 {
+				return buf.String()
+			}
+			// Keep the code on either side apart
+			buf.WriteByte(' ')
+			i += 2 + end + 1
+		default:
+			buf.WriteByte(c)
+		}
+	}
+	return buf.String()
+}
+
+// Returns the $262 capabilities used by source outside of comments, sorted.
+func findHostCapabilities(source string) []string {
+	seen := make(map[string]bool)
+	var capabilities []string
+	for _, match := range hostCapabilityRegexp.FindAllStringSubmatch(stripComments(source), -1) {
+		if !seen[match[1]] {
+			seen[match[1]] = true
+			capabilities = append(capabilities, match[1])
+		}
+	}
+	sort.Strings(capabilities)
+	return capabilities
+}
+
+// Whether the engine provides a $262 capability, natively or through its
+// shims. Engines without a $262 (NoHost262) provide none; other engines that
+// don't list their capabilities are assumed to provide them all.
+func (engine *Engine) HasHostCapability(capability string) bool {
+	if capability == "agent" && (len(engine.AgentShim) > 0 || len(engine.AgentHook) > 0) {
+		return true
+	}
+	if engine.Host262 == NoHost262 {
+		return false
+	}
+	if engine.HostCapabilities == nil {
+		return true
+	}
+	for _, c := range engine.HostCapabilities {
+		if c == capability {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the $262 capabilities this test needs, from its own code, and from
+// the harness files it includes.
+func (testcase *TestCase) HostCapabilities() []string {
+	return testcase.hostCapabilitiesFor(testcase.global.engine)
+}
+
+// Returns the $262 capabilities this test needs when run with engine, whose
+// harness files may differ.
+func (testcase *TestCase) hostCapabilitiesFor(engine *Engine) []string {
+	h := testcase.global.harnessIncludesFor(engine)
+
+	// Errors are caught by verifyIncludes
+	includes, _ := h.resolve(testcase.Metadata.Features, testcase.Metadata.Includes)
+	if !testcase.HasFlag(RawFlag) {
+		includes = append(includes, standardIncludes...)
+	}
+
+	seen := make(map[string]bool)
+	var capabilities []string
+	add := func(list []string) {
+		for _, c := range list {
+			if !seen[c] {
+				seen[c] = true
+				capabilities = append(capabilities, c)
+			}
+		}
+	}
+
+	add(testcase.hostCapabilities)
+	for _, name := range includes {
+		if inc := h.lookup(name); inc != nil {
+			add(inc.hostCapabilities)
+		}
+	}
+	sort.Strings(capabilities)
+	return capabilities
+}
+
+// Returns the $262 capabilities this test needs which the engine lacks. The
+// test can't run until they are provided.
+func (testcase *TestCase) UnsupportedHostCapabilities() []string {
+	return testcase.unsupportedHostCapabilities(testcase.global.engine)
+}
+
+func (testcase *TestCase) unsupportedHostCapabilities(engine *Engine) []string {
+	var missing []string
+	for _, c := range testcase.hostCapabilitiesFor(engine) {
+		if !engine.HasHostCapability(c) {
+			missing = append(missing, c)
+		}
+	}
+	return missing
+}
+
+// Returns what this test needs but the engine lacks, e.g. "$262.createRealm",
+// or a CanBlockIsTrue flag the engine can't honour. The test can't run until
+// they are provided.
+func (testcase *TestCase) UnsupportedRequirements() []string {
+	return testcase.unsupportedRequirements(testcase.global.engine)
+}
+
+func (testcase *TestCase) unsupportedRequirements(engine *Engine) []string {
+	var missing []string
+	for _, c := range testcase.unsupportedHostCapabilities(engine) {
+		missing = append(missing, "$262."+c)
+	}
+	if _, flag := engine.argsFor(testcase, ""); len(flag) > 0 {
+		missing = append(missing, flag)
+	}
+	return missing
+}
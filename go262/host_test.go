@@ -0,0 +1,82 @@
+/*
+ * Copyright (c) 2017 Crimson AS <info@crimson.no>
+ * Author: Robin Burchell <robin.burchell@crimson.no>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package go262
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFindHostCapabilities(t *testing.T) {
+	tests := []struct {
+		source       string
+		capabilities string
+	}{
+		{"$262.createRealm(); $262.gc(); $262.createRealm();", "createRealm,gc"},
+		{"// $262.createRealm()\n$262.gc();", "gc"},
+		{"/* uses $262.agent\n * and $262.detachArrayBuffer */ foo();", ""},
+		{"var s = '// $262.evalScript'; $262.gc();", "evalScript,gc"},
+		{"var s = \"/* $262.evalScript\"; $262.gc(); // */", "evalScript,gc"},
+		{"var s = `\n// $262.agent\n`;", "agent"},
+		{"x = 'it\\'s'; // $262.gc\n", ""},
+	}
+
+	for _, test := range tests {
+		if got := strings.Join(findHostCapabilities(test.source), ","); got != test.capabilities {
+			t.Errorf("findHostCapabilities(%q) = %s, want %s", test.source, got, test.capabilities)
+		}
+	}
+}
+
+func TestHasHostCapability(t *testing.T) {
+	tests := []struct {
+		host262      string
+		capabilities []string
+		agentShim    string
+		agentHook    string
+		capability   string
+		want         bool
+	}{
+		// Unless told otherwise, engines are assumed to have everything
+		{"", nil, "", "", "createRealm", true},
+		{NativeHost262, nil, "", "", "agent", true},
+		{NativeHost262, []string{"gc"}, "", "", "createRealm", false},
+		{"shims/262.js", []string{"gc"}, "", "", "gc", true},
+		{NoHost262, nil, "", "", "gc", false},
+		{NoHost262, nil, "shims/agent.js", "", "agent", true},
+		{"shims/262.js", []string{"gc"}, "", "", "agent", false},
+		{"shims/262.js", []string{"gc"}, "", "shims/agent-hook.js", "agent", true},
+	}
+
+	for _, test := range tests {
+		engine := NewEngine("/bin/true")
+		engine.Host262 = test.host262
+		engine.HostCapabilities = test.capabilities
+		engine.AgentShim = test.agentShim
+		engine.AgentHook = test.agentHook
+		if got := engine.HasHostCapability(test.capability); got != test.want {
+			t.Errorf("host262 %q, capabilities %v, agent shim %q, agent hook %q: HasHostCapability(%s) = %v, want %v", test.host262, test.capabilities, test.agentShim, test.agentHook, test.capability, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,203 @@
+/*
+ * Copyright (c) 2017 Crimson AS <info@crimson.no>
+ * Author: Robin Burchell <robin.burchell@crimson.no>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package go262
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// All flags test262 defines
+var knownFlags = []string{
+	StrictFlag,
+	NonStrictFlag,
+	RawFlag,
+	ModuleFlag,
+	AsyncFlag,
+	GeneratedFlag,
+	CanBlockIsFalseFlag,
+	CanBlockIsTrueFlag,
+	NonDeterministicFlag,
+}
+
+// A problem with a test's metadata, found by the linter
+type LintProblem struct {
+	PathName string
+
+	// The line of the test file the problem is on (starting at 1)
+	Line int
+
+	Message string
+}
+
+func (problem *LintProblem) String() string {
+	return fmt.Sprintf("%s:%d: %s", problem.PathName, problem.Line, problem.Message)
+}
+
+// Read the feature names test262 knows about from its features.txt. Returns
+// nil if there is no such file.
+func (global *GlobalState) readKnownFeatures() map[string]bool {
+	f, err := os.Open(global.rootPath + "/features.txt")
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	features := make(map[string]bool)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = strings.TrimSpace(line[:i])
+		}
+		if len(line) > 0 {
+			features[line] = true
+		}
+	}
+	return features
+}
+
+// Returns the line of the last definition of a top-level key in the
+// frontmatter, or the line of the frontmatter itself if the key isn't there.
+func (fm *frontmatter) keyLine(key string) int {
+	re := regexp.MustCompile("^" + regexp.QuoteMeta(key) + `\s*:`)
+	found := fm.line
+	for i, line := range strings.Split(fm.yaml, "\n") {
+		if re.MatchString(line) {
+			found = fm.line + i
+		}
+	}
+	return found
+}
+
+// Lint the metadata of a test file, in the way test262 expects it before
+// submitting a test. knownFeatures may be nil to skip checking features.
+func (global *GlobalState) lintFile(pathName string, knownFeatures map[string]bool) []*LintProblem {
+	var problems []*LintProblem
+	report := func(line int, message string) {
+		problems = append(problems, &LintProblem{pathName, line, message})
+	}
+
+	contents, err := ioutil.ReadFile(pathName)
+	if err != nil {
+		report(0, "Can't read: "+err.Error())
+		return problems
+	}
+
+	fm, err := scanFrontmatter(string(contents))
+	if err != nil {
+		report(err.(*FrontmatterError).Line, err.(*FrontmatterError).Message)
+		return problems
+	} else if fm == nil {
+		report(1, "No frontmatter")
+		return problems
+	}
+
+	test := &TestCase{PathName: pathName, global: global}
+	test.Metadata, err = load(fm.yaml)
+	if err != nil {
+		ferr := yamlError(fm, err).(*FrontmatterError)
+		report(ferr.Line, ferr.Message)
+		return problems
+	}
+
+	// Whatever ParseMetadata would refuse
+	for _, message := range test.validateMetadata() {
+		report(fm.line, message)
+	}
+
+	dups, _ := duplicateKeys(fm.yaml)
+	for _, key := range dups {
+		report(fm.keyLine(key), "Duplicate key "+key)
+	}
+
+	if len(test.Metadata.EsId) == 0 {
+		report(fm.line, "Missing esid")
+	}
+
+	for _, flag := range test.Metadata.Flags {
+		known := false
+		for _, k := range knownFlags {
+			known = known || flag == k
+		}
+		if !known {
+			report(fm.keyLine("flags"), "Unknown flag "+flag)
+		}
+	}
+
+	if knownFeatures != nil {
+		for _, feature := range test.Metadata.Features {
+			if !knownFeatures[feature] {
+				report(fm.keyLine("features"), "Unknown feature "+feature+" (not in features.txt)")
+			}
+		}
+	}
+
+	for _, inc := range test.Metadata.Includes {
+		if _, err := global.harnessIncludes().resolve(nil, []string{inc}); err != nil {
+			report(fm.keyLine("includes"), "Missing include: "+err.Error())
+		}
+	}
+
+	return problems
+}
+
+// Lint all tests at pathName like Lint, without walking and parsing the
+// test262 checkout at rootPath first: only its harness (layered with the
+// engine's) and features.txt are read.
+func LintFiles(rootPath string, engine *Engine, pathName string) ([]*LintProblem, error) {
+	global := newGlobalState(rootPath)
+	global.engine = engine
+	if err := global.readIncludeCaches(); err != nil {
+		return nil, err
+	}
+	return global.Lint(pathName), nil
+}
+
+// Lint all tests at pathName (a test file, or a directory of them). This
+// needn't be inside the test262 checkout, so new tests can be checked before
+// they are added to it.
+func (global *GlobalState) Lint(pathName string) []*LintProblem {
+	knownFeatures := global.readKnownFeatures()
+
+	var problems []*LintProblem
+	filepath.Walk(pathName, func(pathName string, info os.FileInfo, err error) error {
+		if err != nil {
+			problems = append(problems, &LintProblem{pathName, 0, "Can't read: " + err.Error()})
+			return nil
+		}
+		// Fixtures are only imported by other tests
+		if info.IsDir() || !strings.HasSuffix(pathName, ".js") || strings.HasSuffix(pathName, "_FIXTURE.js") {
+			return nil
+		}
+		problems = append(problems, global.lintFile(pathName, knownFeatures)...)
+		return nil
+	})
+	return problems
+}
@@ -0,0 +1,149 @@
+/*
+ * Copyright (c) 2017 Crimson AS <info@crimson.no>
+ * Author: Robin Burchell <robin.burchell@crimson.no>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package go262
+
+import (
+	"encoding/gob"
+	"log"
+	"os"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// Where parsed metadata is cached between startups
+const metadataCacheFile = "MetadataCache"
+
+// Bump this whenever parsing changes, so stale caches aren't used.
+const metadataCacheVersion = 5
+
+type metadataCache struct {
+	Version int
+
+	// PathName -> parsed metadata
+	Tests map[string]*cachedMetadata
+}
+
+// The parsed metadata of a test, and what is needed to tell whether the file
+// changed since
+type cachedMetadata struct {
+	ModTime     time.Time
+	Size        int64
+	ContentHash string
+	Metadata    TestMetadata
+
+	// Where the test's data starts in the file
+	DataOffset int
+	DataLine   int
+
+	// The $262 capabilities the test uses
+	HostCapabilities []string
+}
+
+func readMetadataCache() map[string]*cachedMetadata {
+	f, err := os.Open(metadataCacheFile)
+	if err != nil {
+		log.Printf("Can't read metadata cache (this might be OK): %s", err)
+		return nil
+	}
+	defer f.Close()
+
+	cache := metadataCache{}
+	if err := gob.NewDecoder(f).Decode(&cache); err != nil {
+		log.Printf("Can't decode metadata cache, ignoring it: %s", err)
+		return nil
+	}
+	if cache.Version != metadataCacheVersion {
+		return nil
+	}
+	return cache.Tests
+}
+
+func (global *GlobalState) writeMetadataCache() {
+	cache := metadataCache{metadataCacheVersion, make(map[string]*cachedMetadata)}
+	for pathName, test := range global.testMap {
+		cache.Tests[pathName] = &cachedMetadata{
+			test.modTime,
+			test.size,
+			test.contentHash,
+			test.Metadata,
+			test.dataOffset,
+			test.dataLine,
+			test.hostCapabilities,
+		}
+	}
+
+	f, err := os.Create(metadataCacheFile)
+	if err != nil {
+		log.Printf("Can't write metadata cache: %s", err)
+		return
+	}
+	defer f.Close()
+
+	if err := gob.NewEncoder(f).Encode(&cache); err != nil {
+		log.Printf("Can't encode metadata cache: %s", err)
+	}
+}
+
+// Parse all tests, spread over all CPUs. Tests that didn't change since their
+// metadata was cached aren't parsed again.
+func (global *GlobalState) parseAll() {
+	cache := readMetadataCache()
+
+	tests := make(chan *TestCase)
+	wg := sync.WaitGroup{}
+	for i := 0; i < runtime.NumCPU(); i++ {
+		wg.Add(1)
+		go func() {
+			for test := range tests {
+				test.parseCached(cache[test.PathName])
+			}
+			wg.Done()
+		}()
+	}
+
+	for _, test := range global.testMap {
+		tests <- test
+	}
+	close(tests)
+	wg.Wait()
+
+	global.writeMetadataCache()
+}
+
+// Use the cached metadata if the file didn't change since it was cached, and
+// parse the test otherwise.
+func (testcase *TestCase) parseCached(cached *cachedMetadata) {
+	if cached == nil || !cached.ModTime.Equal(testcase.modTime) || cached.Size != testcase.size {
+		testcase.Parse()
+		return
+	}
+
+	testcase.contentHash = cached.ContentHash
+	testcase.Metadata = cached.Metadata
+	testcase.dataOffset = cached.DataOffset
+	testcase.dataLine = cached.DataLine
+	testcase.hostCapabilities = cached.HostCapabilities
+	testcase.verifyIncludes()
+}
@@ -0,0 +1,148 @@
+/*
+ * Copyright (c) 2017 Crimson AS <info@crimson.no>
+ * Author: Robin Burchell <robin.burchell@crimson.no>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package go262
+
+import (
+	"errors"
+)
+
+// Add an engine to run jobs with besides the main one, e.g. another build of
+// it, so their results can be compared side by side. Engines are told apart
+// by their names, so an engine named like another one isn't added, and neither
+// is one whose harness files can't be read. Both return an error. Adding an
+// engine that was already added does nothing.
+func (global *GlobalState) AddEngine(engine *Engine) error {
+	for _, e := range global.Engines() {
+		if e == engine {
+			return nil
+		} else if e.Name == engine.Name {
+			return errors.New("another engine is already named " + engine.Name)
+		}
+	}
+
+	global.others = append(global.others, engine)
+	if err := global.readIncludeCaches(); err != nil {
+		global.others = global.others[:len(global.others)-1]
+		return err
+	}
+
+	// Its harness may lack what tests include
+	for _, test := range global.testMap {
+		test.verifyIncludes()
+	}
+	global.restoreEngineResults(engine)
+	return nil
+}
+
+// Returns every engine jobs are run with: the main one first, and then those
+// added with AddEngine.
+func (global *GlobalState) Engines() []*Engine {
+	return append([]*Engine{global.engine}, global.others...)
+}
+
+// Returns the engine with the given name, or nil.
+func (global *GlobalState) EngineByName(name string) *Engine {
+	for _, engine := range global.Engines() {
+		if engine.Name == name {
+			return engine
+		}
+	}
+	return nil
+}
+
+// Returns the last result of the test for a run type with an engine, or nil.
+func (testcase *TestCase) GetResultWith(engine *Engine, runType string) *TestResult {
+	if engine == testcase.global.engine {
+		return testcase.GetLastResultFor(runType)
+	}
+
+	testcase.caseLock.Lock()
+	defer testcase.caseLock.Unlock()
+	return testcase.engineResults[engine][runType]
+}
+
+// Runs the job with an engine besides the main one, retrying it like
+// RunWithRetries, unless its last result for it is still current.
+func (testcase *TestCase) runOtherEngine(engine *Engine, job *TestJob, retries int) {
+	if !engine.hasRunType(job.RunType) || testcase.isCurrent(testcase.GetResultWith(engine, job.RunType), engine) {
+		return
+	}
+
+	testcase.setResultWith(engine, testcase.runWithRetries(engine, job, retries))
+}
+
+func (testcase *TestCase) setResultWith(engine *Engine, tr *TestResult) {
+	testcase.caseLock.Lock()
+	if testcase.engineResults[engine] == nil {
+		testcase.engineResults[engine] = make(map[string]*TestResult)
+	}
+	testcase.engineResults[engine][tr.RunType] = tr
+	testcase.caseLock.Unlock()
+}
+
+// The state of the test for a run type with an engine (see StateValue).
+func (testcase *TestCase) StateValueWith(engine *Engine, runType string) string {
+	// Test doesn't run in this mode
+	if !testcase.HasRunType(runType) || !engine.hasRunType(runType) || testcase.IsExcluded() {
+		return WillNotRunState
+	}
+
+	res := testcase.GetResultWith(engine, runType)
+	if res == nil {
+		return HasNotRunState
+	}
+
+	if len(res.Unsupported) > 0 {
+		return UnsupportedState
+	} else if res.Flaky {
+		return FlakyState
+	} else if res.IsSuccessful() {
+		return SuccessState
+	} else {
+		return FailureState
+	}
+}
+
+// Whether the test passes with engine a, but fails with engine b, for any run
+// type.
+func (testcase *TestCase) PassesOnlyWith(a *Engine, b *Engine) bool {
+	for _, runType := range testcase.global.RunTypes() {
+		stateA := testcase.StateValueWith(a, runType)
+		if (stateA == SuccessState || stateA == FlakyState) && testcase.StateValueWith(b, runType) == FailureState {
+			return true
+		}
+	}
+	return false
+}
+
+// Get results for this suite with an engine
+func (suite *TestSuite) CalculateResultsWith(engine *Engine) SuiteResults {
+	r := newSuiteResults()
+
+	for _, test := range suite.Tests {
+		r.addTestWith(test, engine)
+	}
+
+	return r
+}
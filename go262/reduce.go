@@ -0,0 +1,286 @@
+/*
+ * Copyright (c) 2017 Crimson AS <info@crimson.no>
+ * Author: Robin Burchell <robin.burchell@crimson.no>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package go262
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// How many times reducing a job may run the engine
+const MaxReductionRuns = 500
+
+// The outcome of reducing a failing job to a smaller test failing the same way
+type Reduction struct {
+	RunType string
+	Date    time.Time
+
+	// The test's code, and what is left of it
+	Original string
+	Reduced  string
+
+	// How the job failed, which the reduced code still does
+	ExitSuccess  bool
+	ErrorType    string
+	ErrorMessage string
+
+	// How many times the engine was run
+	Runs int
+}
+
+// Returns the bracket depth at the start and the end of each line, roughly:
+// strings, template literals and comments are skipped, but regular expression
+// literals aren't recognised.
+func lineDepths(lines []string) ([]int, []int) {
+	starts := make([]int, len(lines))
+	ends := make([]int, len(lines))
+	depth := 0
+	inComment, inTemplate := false, false
+
+	for n, line := range lines {
+		starts[n] = depth
+		if inComment || inTemplate {
+			// Can't start or end a statement in there
+			starts[n] = -1
+		}
+
+		quote := byte(0)
+		for i := 0; i < len(line); i++ {
+			c := line[i]
+			switch {
+			case inComment:
+				if c == '*' && i+1 < len(line) && line[i+1] == '/' {
+					inComment = false
+					i++
+				}
+			case inTemplate:
+				if c == '\\' {
+					i++
+				} else if c == '`' {
+					inTemplate = false
+				}
+			case quote != 0:
+				if c == '\\' {
+					i++
+				} else if c == quote {
+					quote = 0
+				}
+			case c == '/' && i+1 < len(line) && line[i+1] == '/':
+				i = len(line)
+			case c == '/' && i+1 < len(line) && line[i+1] == '*':
+				inComment = true
+				i++
+			case c == '\'' || c == '"':
+				quote = c
+			case c == '`':
+				inTemplate = true
+			case c == '{' || c == '[' || c == '(':
+				depth++
+			case c == '}' || c == ']' || c == ')':
+				depth--
+			}
+		}
+
+		ends[n] = depth
+		if inComment || inTemplate {
+			ends[n] = -1
+		}
+	}
+
+	return starts, ends
+}
+
+// Returns the top-level statements and blocks of code, as ranges of lines
+// [start, end), and the single-line statements inside blocks.
+func reductionUnits(lines []string) ([][2]int, [][2]int) {
+	starts, ends := lineDepths(lines)
+
+	var topLevel, nested [][2]int
+	first := 0
+	for n := range lines {
+		if ends[n] == 0 {
+			topLevel = append(topLevel, [2]int{first, n + 1})
+			first = n + 1
+		}
+		if starts[n] > 0 && starts[n] == ends[n] && strings.HasSuffix(strings.TrimSpace(lines[n]), ";") {
+			nested = append(nested, [2]int{n, n + 1})
+		}
+	}
+	if first < len(lines) {
+		topLevel = append(topLevel, [2]int{first, len(lines)})
+	}
+
+	return topLevel, nested
+}
+
+// Reduces a test, keeping track of what is left of it
+type reducer struct {
+	testcase *TestCase
+	job      *TestJob
+	lines    []string
+	removed  []bool
+
+	// How the job originally failed
+	want *TestResult
+
+	// Where the engine runs take their slots, so reductions share the
+	// machine with test runs
+	pool *WorkerPool
+
+	runs     int
+	progress func(string)
+}
+
+// Returns the test's code without the removed lines, and those in units.
+func (r *reducer) code(without [][2]int) string {
+	skip := append([]bool{}, r.removed...)
+	for _, unit := range without {
+		for n := unit[0]; n < unit[1]; n++ {
+			skip[n] = true
+		}
+	}
+
+	code := ""
+	for n, line := range r.lines {
+		if !skip[n] {
+			code += line + "\n"
+		}
+	}
+	return code
+}
+
+// Runs the job with data as the test's code, once a slot is free in the pool.
+func (r *reducer) run(data string) *TestResult {
+	slots := r.pool.acquire(r.job.Weight())
+	defer r.pool.release(slots)
+	r.runs++
+	return r.testcase.runWith(r.testcase.global.engine, r.job, data)
+}
+
+// Whether the job still fails the same way without units. If it does, they
+// are removed for good.
+func (r *reducer) tryRemove(units [][2]int) bool {
+	res := r.run(r.code(units))
+	if res.IsSuccessful() || res.success != r.want.success || res.ErrorType != r.want.ErrorType || res.ErrorMessage != r.want.ErrorMessage {
+		return false
+	}
+
+	for _, unit := range units {
+		for n := unit[0]; n < unit[1]; n++ {
+			r.removed[n] = true
+		}
+	}
+	r.progress(fmt.Sprintf("Removed %d lines (%d runs)", r.removedCount(), r.runs))
+	return true
+}
+
+func (r *reducer) removedCount() int {
+	count := 0
+	for _, removed := range r.removed {
+		if removed {
+			count++
+		}
+	}
+	return count
+}
+
+// Try removing units in ever smaller chunks, starting with all of them, until
+// single units have been tried (or the engine has been run too many times).
+func (r *reducer) reduceUnits(units [][2]int) {
+	for chunk := len(units); chunk >= 1; chunk /= 2 {
+		for i := 0; i < len(units) && r.runs < MaxReductionRuns; i += chunk {
+			end := i + chunk
+			if end > len(units) {
+				end = len(units)
+			}
+
+			// Don't bother with what's already gone
+			var candidates [][2]int
+			for _, unit := range units[i:end] {
+				if !r.removed[unit[0]] {
+					candidates = append(candidates, unit)
+				}
+			}
+			if len(candidates) > 0 {
+				r.tryRemove(candidates)
+			}
+		}
+	}
+}
+
+// Reduce a failing job to a smaller test that the engine still fails the same
+// way (with the same exception type and message), by removing top-level
+// statements and blocks, and then statements inside blocks. progress is told
+// how it goes. The engine is run in slots of pool, like jobs on its queues.
+// The result is kept, see LastReduction.
+func (testcase *TestCase) Reduce(job *TestJob, pool *WorkerPool, progress func(string)) (*Reduction, error) {
+	data := testcase.TestData()
+	r := &reducer{testcase, job, nil, nil, nil, pool, 0, progress}
+	want := r.run(data)
+	if len(want.Unsupported) > 0 {
+		return nil, errors.New("the engine can't run this test")
+	} else if want.IsSuccessful() {
+		return nil, errors.New("the test doesn't fail")
+	}
+
+	lines := strings.Split(strings.TrimSuffix(data, "\n"), "\n")
+	r.lines, r.removed, r.want = lines, make([]bool, len(lines)), want
+	topLevel, nested := reductionUnits(lines)
+
+	// Removing something can make something else removable (e.g. a function
+	// once its callers are gone), so go on while that helps
+	for r.runs < MaxReductionRuns {
+		before := r.removedCount()
+		r.reduceUnits(topLevel)
+		r.reduceUnits(nested)
+		if r.removedCount() == before {
+			break
+		}
+	}
+
+	red := &Reduction{
+		job.RunType,
+		time.Now(),
+		data,
+		r.code(nil),
+		want.success,
+		want.ErrorType,
+		want.ErrorMessage,
+		r.runs,
+	}
+
+	testcase.caseLock.Lock()
+	testcase.reductions[job.RunType] = red
+	testcase.caseLock.Unlock()
+	return red, nil
+}
+
+// Returns the last reduction of the test for a run type, or nil.
+func (testcase *TestCase) LastReduction(runType string) *Reduction {
+	testcase.caseLock.Lock()
+	defer testcase.caseLock.Unlock()
+	return testcase.reductions[runType]
+}
@@ -0,0 +1,103 @@
+/*
+ * Copyright (c) 2017 Crimson AS <info@crimson.no>
+ * Author: Robin Burchell <robin.burchell@crimson.no>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package go262
+
+import (
+	"sort"
+)
+
+// Set an engine to compare results with (e.g. node). It is added to the
+// engines jobs are run with, and tests on which it disagrees with the main
+// engine can be found with FindDisagreements. Pass nil to stop comparing.
+// Fails if the engine can't be added (see AddEngine).
+func (global *GlobalState) SetReferenceEngine(engine *Engine) error {
+	if engine != nil {
+		if err := global.AddEngine(engine); err != nil {
+			return err
+		}
+	}
+	global.reference = engine
+	return nil
+}
+
+func (global *GlobalState) ReferenceEngine() *Engine {
+	return global.reference
+}
+
+func (testcase *TestCase) GetReferenceResultFor(runType string) *TestResult {
+	if testcase.global.reference == nil {
+		return nil
+	}
+	return testcase.GetResultWith(testcase.global.reference, runType)
+}
+
+// Whether the engine and the reference engine disagree on the outcome of the
+// last run of the test, or on the type of exception thrown. Tests either
+// engine couldn't run don't count.
+func (testcase *TestCase) Disagrees(runType string) bool {
+	res := testcase.GetLastResultFor(runType)
+	ref := testcase.GetReferenceResultFor(runType)
+	if res == nil || ref == nil || len(res.Unsupported) > 0 || len(ref.Unsupported) > 0 {
+		return false
+	}
+
+	return res.IsSuccessful() != ref.IsSuccessful() || res.ErrorType != ref.ErrorType
+}
+
+// A test on which the engine and the reference engine disagree
+type Disagreement struct {
+	Test    *TestCase
+	RunType string
+
+	// The last results of the engine, and of the reference
+	Result    *TestResult
+	Reference *TestResult
+}
+
+type disagreementSorter []*Disagreement
+
+func (a disagreementSorter) Len() int      { return len(a) }
+func (a disagreementSorter) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
+func (a disagreementSorter) Less(i, j int) bool {
+	if a[i].Test.PathName != a[j].Test.PathName {
+		return a[i].Test.PathName < a[j].Test.PathName
+	}
+	return a[i].RunType < a[j].RunType
+}
+
+// Returns every test on which the engine and the reference engine disagree,
+// sorted by path.
+func (global *GlobalState) FindDisagreements() []*Disagreement {
+	var found []*Disagreement
+	for _, test := range global.testMap {
+		for _, runType := range global.RunTypes() {
+			if test.Disagrees(runType) {
+				found = append(found, &Disagreement{test, runType, test.GetLastResultFor(runType), test.GetReferenceResultFor(runType)})
+			}
+		}
+	}
+
+	sort.Sort(disagreementSorter(found))
+	return found
+}
@@ -0,0 +1,142 @@
+/*
+ * Copyright (c) 2017 Crimson AS <info@crimson.no>
+ * Author: Robin Burchell <robin.burchell@crimson.no>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package go262
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// Environment variables that can change how an engine behaves, and are kept in
+// reproductions. The rest of the environment is left out, as it may hold
+// secrets.
+var reproEnvironment = []string{"LANG", "LC_ALL", "LC_CTYPE", "TZ"}
+
+// A file in a reproduction tarball
+type reproFile struct {
+	name string
+	data string
+	mode int64
+}
+
+// Quote s for a POSIX shell.
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+// Returns what the test is expected to do, in words.
+func (testcase *TestCase) ExpectedOutcome() string {
+	if testcase.IsNegative() {
+		return fmt.Sprintf("throw a %s in the %s phase", testcase.Metadata.Negative.Type, testcase.Metadata.Negative.Phase)
+	}
+	return "run without throwing"
+}
+
+// Write a gzipped tarball reproducing the job outside go262: the code exactly
+// as it is run, a shell script running it with the engine, and what is known
+// about the last run.
+func (testcase *TestCase) WriteRepro(job *TestJob, w io.Writer) error {
+	engine := testcase.global.engine
+	src := testcase.buildSource(job, engine, testcase.TestData())
+	dir := "repro-" + strings.TrimSuffix(testcase.FileName(), ".js") + "-" + job.RunType + "/"
+
+	args, unsupported := engine.argsFor(testcase, job.RunType)
+	script := "#!/bin/sh\n"
+	script += "# Reproduces " + testcase.PathName + " (" + job.RunType + ")\n"
+	script += "cd \"$(dirname \"$0\")\"\n"
+	for _, name := range reproEnvironment {
+		if value, ok := os.LookupEnv(name); ok {
+			script += "export " + name + "=" + shellQuote(value) + "\n"
+		}
+	}
+	script += "exec " + shellQuote(engine.Path)
+	for _, arg := range args {
+		script += " " + shellQuote(arg)
+	}
+	for _, file := range src.files() {
+		script += " " + file.Name
+	}
+	script += "\n"
+
+	info := fmt.Sprintf("Test: %s\n", testcase.PathName)
+	info += fmt.Sprintf("Run type: %s\n", job.RunType)
+	info += fmt.Sprintf("Expected to: %s\n", testcase.ExpectedOutcome())
+	info += fmt.Sprintf("Engine: %s (%s)\n", engine.Name, engine.Path)
+	info += fmt.Sprintf("Engine version: %s\n", engine.Version())
+	info += fmt.Sprintf("Engine hash: %s\n", engine.Hash())
+	info += fmt.Sprintf("Platform: %s/%s\n", runtime.GOOS, runtime.GOARCH)
+	if len(unsupported) > 0 {
+		info += fmt.Sprintf("Unsupported: the engine can't be run with %s\n", unsupported)
+	}
+	if engine.HostArgs != nil {
+		info += "Note: go262 ran this in a persistent host; run.sh starts a process of its own\n"
+	}
+
+	files := []reproFile{
+		{"run.sh", script, 0755},
+		{"info.txt", info, 0644},
+	}
+	for _, file := range src.files() {
+		files = append(files, reproFile{file.Name, file.Source, 0644})
+	}
+
+	if res := testcase.GetLastResultFor(job.RunType); res != nil {
+		result := fmt.Sprintf("Successful: %t\n", res.IsSuccessful())
+		if len(res.ErrorType) > 0 {
+			result += fmt.Sprintf("Threw: %s: %s\n", res.ErrorType, res.ErrorMessage)
+		}
+		result += fmt.Sprintf("Took: %s\n", res.ExecutionDuration)
+		files = append(files, reproFile{"last-result.txt", result, 0644})
+		files = append(files, reproFile{"last-stderr.txt", res.StderrOutput, 0644})
+		files = append(files, reproFile{"last-stdout.txt", res.StdoutOutput, 0644})
+	}
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	now := time.Now()
+	for _, f := range files {
+		hdr := &tar.Header{
+			Name:    dir + f.name,
+			Mode:    f.mode,
+			Size:    int64(len(f.data)),
+			ModTime: now,
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if _, err := io.WriteString(tw, f.data); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
@@ -0,0 +1,192 @@
+/*
+ * Copyright (c) 2017 Crimson AS <info@crimson.no>
+ * Author: Robin Burchell <robin.burchell@crimson.no>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package go262
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+type testSorter []*TestCase
+
+func (a testSorter) Len() int      { return len(a) }
+func (a testSorter) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
+func (a testSorter) Less(i, j int) bool {
+	return a[i].PathName < a[j].PathName
+}
+
+type suiteSorter []*TestSuite
+
+func (a suiteSorter) Len() int      { return len(a) }
+func (a suiteSorter) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
+func (a suiteSorter) Less(i, j int) bool {
+	return a[i].PathName < a[j].PathName
+}
+
+// Rescan the test262 checkout (e.g. after a git pull), without losing state.
+//
+// Harness includes are reread. Tests and suites are added and removed to match
+// the tree. Tests whose content changed are reparsed into new TestCase
+// instances (so jobs already running with the old ones aren't disturbed), and
+// lose their results. Tests whose content didn't change keep their results.
+// Tests whose includes can't be found are marked broken (see IncludeError).
+//
+// Returns the tests that were added or changed. If the harness can't be
+// reread, the one read before is kept, and the error is returned too.
+func (global *GlobalState) Rescan() ([]*TestCase, error) {
+	global.treeLock.Lock()
+	defer global.treeLock.Unlock()
+
+	harnessErr := global.readIncludeCaches()
+	if harnessErr != nil {
+		log.Printf("Can't reread the harness, keeping the old one: %s", harnessErr.Error())
+	}
+
+	seen := make(map[string]bool)
+	touched := make(map[*TestSuite]bool)
+	var changed []*TestCase
+
+	filepath.Walk(global.rootPath+"/test", func(pathName string, info os.FileInfo, err error) error {
+		if err != nil {
+			log.Printf("Can't rescan %s: %s", pathName, err.Error())
+			return nil
+		}
+
+		pathName = path.Clean(pathName)
+		seen[pathName] = true
+
+		if info.IsDir() {
+			if global.FetchSuite(pathName) == nil {
+				global.createSuiteIfNeeded(pathName)
+				touched[global.FetchSuite(path.Dir(pathName))] = true
+			}
+			return nil
+		}
+
+		old := global.testMap[pathName]
+		if old != nil && old.modTime.Equal(info.ModTime()) && old.size == info.Size() {
+			return nil
+		}
+
+		contents, err := ioutil.ReadFile(pathName)
+		if err != nil {
+			log.Printf("Can't rescan %s: %s", pathName, err.Error())
+			return nil
+		}
+
+		if old != nil && old.contentHash == hashSource(string(contents)) {
+			// Only touched, keep it (and its results)
+			old.modTime = info.ModTime()
+			old.size = info.Size()
+			return nil
+		}
+
+		suite := global.FetchSuite(path.Dir(pathName))
+		if old != nil {
+			suite.removeTest(old)
+		}
+		test := suite.createTestCase(pathName)
+		test.modTime = info.ModTime()
+		test.size = info.Size()
+		test.parseContents(contents)
+		touched[suite] = true
+		changed = append(changed, test)
+		return nil
+	})
+
+	// Drop whatever is gone
+	removed := 0
+	for pathName, test := range global.testMap {
+		if !seen[pathName] {
+			test.Suites[0].removeTest(test)
+			delete(global.testMap, pathName)
+			removed++
+		}
+	}
+	for pathName, suite := range global.suiteMap {
+		if suite == global.rootSuite || seen[pathName] {
+			continue
+		}
+		parent := global.FetchSuite(path.Dir(pathName))
+		if parent != nil {
+			parent.removeSuite(suite)
+		}
+		delete(global.suiteMap, pathName)
+	}
+
+	// Includes of unchanged tests may have appeared or gone with the harness
+	if harnessErr == nil {
+		reparsed := make(map[*TestCase]bool)
+		for _, test := range changed {
+			reparsed[test] = true
+		}
+		for _, test := range global.testMap {
+			if !reparsed[test] {
+				test.verifyIncludes()
+			}
+		}
+	}
+
+	// Keep everything in the order a fresh walk would have
+	for suite := range touched {
+		sort.Sort(testSorter(suite.Tests))
+		sort.Sort(suiteSorter(suite.Suites))
+	}
+
+	if len(changed) > 0 || removed > 0 {
+		log.Printf("Rescanned %s: %d tests added or changed, %d removed", global.rootPath, len(changed), removed)
+		global.writeMetadataCache()
+	}
+	return changed, harnessErr
+}
+
+// Rescan the test262 checkout every interval, forever.
+func (global *GlobalState) AutoRescan(interval time.Duration) {
+	for range time.Tick(interval) {
+		global.Rescan()
+	}
+}
+
+func (suite *TestSuite) removeTest(test *TestCase) {
+	for i, t := range suite.Tests {
+		if t == test {
+			suite.Tests = append(suite.Tests[:i], suite.Tests[i+1:]...)
+			return
+		}
+	}
+}
+
+func (suite *TestSuite) removeSuite(child *TestSuite) {
+	for i, s := range suite.Suites {
+		if s == child {
+			suite.Suites = append(suite.Suites[:i], suite.Suites[i+1:]...)
+			return
+		}
+	}
+}
@@ -24,7 +24,6 @@
 package go262
 
 import (
-	"regexp"
 	"time"
 )
 
@@ -43,19 +42,57 @@ type TestResult struct {
 
 	// How long it took to run
 	ExecutionDuration time.Duration
+
+	// The constructor name of the uncaught exception (if any), as found by the
+	// engine
+	ErrorType string
+
+	// The message of the uncaught exception (if any)
+	ErrorMessage string
+
+	// Every attempt at running the job, in order, when failures are retried.
+	// The last attempt is this result. Only the outcome and error type of
+	// earlier attempts are kept (see outcome).
+	Attempts []*TestResult
+
+	// Whether the outcomes of the attempts disagreed
+	Flaky bool
+
+	// Hash of the scripts that were run (see GetSource)
+	SourceHash string
+
+	// Hash of the engine (and its arguments) the source was run with
+	EngineHash string
+
+	// What the test needs but the engine lacks (see UnsupportedRequirements).
+	// If anything, the test wasn't run.
+	Unsupported []string
+}
+
+// Returns a copy of the result without its output, to keep as an earlier
+// attempt.
+func (result *TestResult) outcome() *TestResult {
+	return &TestResult{
+		result.TestJob,
+		result.success,
+		"",
+		"",
+		result.ExecutionDuration,
+		result.ErrorType,
+		"",
+		nil,
+		false,
+		result.SourceHash,
+		result.EngineHash,
+		result.Unsupported,
+	}
 }
 
 func (result *TestResult) IsSuccessful() bool {
 	// ### IsAsyncTest
 	if result.TestCase.IsNegative() {
-		// we want a failure
-		// ### cache this somewhere
-		negMatchRe, err := regexp.Compile(result.TestCase.Metadata.Negative.Type)
-		if err != nil {
-			panic("WTF?")
-		}
-		negativeMatch := negMatchRe.FindStringSubmatch(result.StderrOutput)
-		return !result.success && negativeMatch != nil
+		// we want a failure, throwing exactly the expected type
+		return !result.success && result.ErrorType == result.TestCase.Metadata.Negative.Type
 	}
 
 	return result.success
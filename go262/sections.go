@@ -0,0 +1,95 @@
+/*
+ * Copyright (c) 2017 Crimson AS <info@crimson.no>
+ * Author: Robin Burchell <robin.burchell@crimson.no>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package go262
+
+import (
+	"sort"
+)
+
+// Results for all tests covering a given spec section
+type SectionResults struct {
+	// The section id, e.g. sec-array.prototype.map, or 15.4.4.19
+	Section string
+
+	// Which metadata the id came from: esid, es6id or es5id. Only esid values
+	// are anchors in the current spec.
+	IdType string
+
+	// How many tests cover this section
+	TestCount int
+
+	SuiteResults
+}
+
+// Returns the spec section this test covers, and the type of id it is. The
+// esid is preferred, as es6id and es5id are legacy section numbers.
+func (testcase *TestCase) SectionId() (string, string) {
+	if len(testcase.Metadata.EsId) > 0 {
+		return testcase.Metadata.EsId, "esid"
+	} else if len(testcase.Metadata.Es6Id) > 0 {
+		return testcase.Metadata.Es6Id, "es6id"
+	} else if len(testcase.Metadata.Es5Id) > 0 {
+		return testcase.Metadata.Es5Id, "es5id"
+	}
+	return "", ""
+}
+
+type sectionSorter []*SectionResults
+
+func (a sectionSorter) Len() int      { return len(a) }
+func (a sectionSorter) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
+func (a sectionSorter) Less(i, j int) bool {
+	if a[i].IdType != a[j].IdType {
+		return a[i].IdType < a[j].IdType
+	}
+	return a[i].Section < a[j].Section
+}
+
+// Get results aggregated by spec section, sorted by id type and section. Tests
+// without any section id are not included.
+func (global *GlobalState) CalculateSectionResults() []*SectionResults {
+	sections := make(map[string]*SectionResults)
+
+	for _, test := range global.testMap {
+		section, idType := test.SectionId()
+		if len(section) == 0 {
+			continue
+		}
+		key := idType + ":" + section
+		r := sections[key]
+		if r == nil {
+			r = &SectionResults{section, idType, 0, newSuiteResults()}
+			sections[key] = r
+		}
+		r.TestCount++
+		r.addTest(test)
+	}
+
+	var results []*SectionResults
+	for _, r := range sections {
+		results = append(results, r)
+	}
+	sort.Sort(sectionSorter(results))
+	return results
+}
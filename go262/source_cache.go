@@ -0,0 +1,138 @@
+/*
+ * Copyright (c) 2017 Crimson AS <info@crimson.no>
+ * Author: Robin Burchell <robin.burchell@crimson.no>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package go262
+
+import (
+	"container/list"
+	"io/ioutil"
+	"log"
+	"sync"
+)
+
+// How many test sources are kept in memory by default
+const DefaultSourceCacheSize = 1000
+
+// A least recently used cache of test sources, so they needn't all be kept in
+// memory.
+type sourceCache struct {
+	// Most recently used first
+	order *list.List
+
+	// Test -> element in order
+	entries map[*TestCase]*list.Element
+
+	size int
+
+	// Lock access to everything above
+	cacheLock sync.Mutex
+}
+
+type sourceCacheEntry struct {
+	test *TestCase
+	data string
+}
+
+func newSourceCache(size int) *sourceCache {
+	return &sourceCache{
+		list.New(),
+		make(map[*TestCase]*list.Element),
+		size,
+		sync.Mutex{},
+	}
+}
+
+func (cache *sourceCache) get(test *TestCase) (string, bool) {
+	cache.cacheLock.Lock()
+	defer cache.cacheLock.Unlock()
+
+	e := cache.entries[test]
+	if e == nil {
+		return "", false
+	}
+	cache.order.MoveToFront(e)
+	return e.Value.(*sourceCacheEntry).data, true
+}
+
+func (cache *sourceCache) put(test *TestCase, data string) {
+	cache.cacheLock.Lock()
+	defer cache.cacheLock.Unlock()
+
+	if e := cache.entries[test]; e != nil {
+		e.Value.(*sourceCacheEntry).data = data
+		cache.order.MoveToFront(e)
+		return
+	}
+
+	cache.entries[test] = cache.order.PushFront(&sourceCacheEntry{test, data})
+	for cache.order.Len() > cache.size {
+		oldest := cache.order.Back()
+		delete(cache.entries, oldest.Value.(*sourceCacheEntry).test)
+		cache.order.Remove(oldest)
+	}
+}
+
+func (testcase *TestCase) isChangedOnDisk() bool {
+	testcase.caseLock.Lock()
+	defer testcase.caseLock.Unlock()
+	return testcase.changedOnDisk
+}
+
+// Set how many test sources are kept in memory.
+func (global *GlobalState) SetSourceCacheSize(size int) {
+	global.sources = newSourceCache(size)
+}
+
+// Returns the line of the test's file that its data starts at.
+func (testcase *TestCase) DataLine() int {
+	return testcase.dataLine
+}
+
+// Returns the data of this test (its source, without the header). It is read
+// from disk on demand, and only the most recently used are kept in memory. If
+// the file changed since it was parsed, its data can't be told from its
+// header, and the test can't run until it is rescanned (see Rescan).
+func (testcase *TestCase) TestData() string {
+	if data, ok := testcase.global.sources.get(testcase); ok {
+		return data
+	}
+
+	contents, err := ioutil.ReadFile(testcase.PathName)
+	if err != nil {
+		log.Printf("Can't read test %s: %s", testcase.PathName, err.Error())
+	}
+	changed := err != nil || hashSource(string(contents)) != testcase.contentHash
+	testcase.caseLock.Lock()
+	testcase.changedOnDisk = changed
+	testcase.caseLock.Unlock()
+	if err != nil {
+		return ""
+	} else if changed {
+		log.Printf("Test %s changed since it was parsed, rescan needed", testcase.PathName)
+		return ""
+	}
+
+	data := string(contents[testcase.dataOffset:])
+	testcase.global.sources.put(testcase, data)
+	return data
+}
@@ -0,0 +1,62 @@
+/*
+ * Copyright (c) 2017 Crimson AS <info@crimson.no>
+ * Author: Robin Burchell <robin.burchell@crimson.no>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package go262
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestTestDataChangedOnDisk(t *testing.T) {
+	f, err := ioutil.TempFile("", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	contents := "/*---\nflags: [onlyStrict]\n---*/\nfoo();\n"
+	f.WriteString(contents)
+	f.Close()
+
+	test := &TestCase{PathName: f.Name(), global: newGlobalState("test262")}
+	test.contentHash = hashSource(contents)
+	test.dataOffset = len("/*---\nflags: [onlyStrict]\n---*/\n")
+	if data := test.TestData(); data != "foo();\n" || test.isChangedOnDisk() {
+		t.Fatalf("TestData() = %q, changed %v", data, test.isChangedOnDisk())
+	}
+
+	// A shorter header moves the data, which can't be found any more. Drop
+	// the cached data, so it is reread.
+	ioutil.WriteFile(f.Name(), []byte("/*---\nflags: [noStrict]\n---*/\nbar();\n"), 0644)
+	test.global.SetSourceCacheSize(DefaultSourceCacheSize)
+	if data := test.TestData(); data != "" || !test.isChangedOnDisk() {
+		t.Errorf("After a change, TestData() = %q, changed %v", data, test.isChangedOnDisk())
+	}
+
+	// Until it is changed back
+	ioutil.WriteFile(f.Name(), []byte(contents), 0644)
+	if data := test.TestData(); data != "foo();\n" || test.isChangedOnDisk() {
+		t.Errorf("After changing back, TestData() = %q, changed %v", data, test.isChangedOnDisk())
+	}
+}
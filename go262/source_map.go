@@ -0,0 +1,123 @@
+/*
+ * Copyright (c) 2017 Crimson AS <info@crimson.no>
+ * Author: Robin Burchell <robin.burchell@crimson.no>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package go262
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// A run of lines in the code given to the engine, and the file they came from
+type sourceSegment struct {
+	// The first line of the segment in the code (from 1), and how many
+	// lines it has
+	startLine int
+	lineCount int
+
+	// The file the lines came from, and the line of that file the segment
+	// starts at. The path is empty for code go262 generated.
+	pathName string
+	fileLine int
+}
+
+// A SourceMap tells where the lines of the code given to the engine came
+// from, so positions in its output can be shown in the original files.
+type SourceMap struct {
+	segments []sourceSegment
+}
+
+// Returns the file and line that a line of the code came from. The path is
+// empty if the line was generated.
+func (m *SourceMap) Lookup(line int) (string, int) {
+	for _, seg := range m.segments {
+		if line >= seg.startLine && line < seg.startLine+seg.lineCount {
+			if len(seg.pathName) == 0 {
+				return "", 0
+			}
+			return seg.pathName, seg.fileLine + line - seg.startLine
+		}
+	}
+	return "", 0
+}
+
+// Matches positions like name:12 in engine output, with the file name given
+// as a path, or as a file:// URL
+var positionRegexp = regexp.MustCompile(`(?:file://)?[^\s:()'"]*:\d+`)
+
+// Rewrite positions like fileName:12 (or fileName:12:3) in text to the
+// files and lines they came from. The file name may be in a directory, or in a
+// file:// URL; the whole position is replaced by the path of the file the line
+// came from. Generated lines are left alone.
+func (m *SourceMap) rewrite(text string, fileName string) string {
+	return positionRegexp.ReplaceAllStringFunc(text, func(pos string) string {
+		colon := strings.LastIndexByte(pos, ':')
+		if len(fileName) == 0 || !strings.HasSuffix(pos[:colon], fileName) {
+			return pos
+		}
+		if dir := pos[:colon-len(fileName)]; len(dir) > 0 && !strings.HasSuffix(dir, "/") {
+			// Another file, whose name ends like this one
+			return pos
+		}
+		line, _ := strconv.Atoi(pos[colon+1:])
+		pathName, fileLine := m.Lookup(line)
+		if len(pathName) == 0 {
+			return pos
+		}
+		return pathName + ":" + strconv.Itoa(fileLine)
+	})
+}
+
+// Builds code from pieces, keeping track of where each came from
+type sourceBuilder struct {
+	source string
+	lines  int
+	m      SourceMap
+}
+
+// Append code, which starts at fileLine of pathName (or is generated, if
+// pathName is empty). Every piece starts on a line of its own.
+func (b *sourceBuilder) add(code string, pathName string, fileLine int) {
+	if len(code) == 0 {
+		return
+	}
+	if !strings.HasSuffix(code, "\n") {
+		code += "\n"
+	}
+
+	count := strings.Count(code, "\n")
+	b.m.segments = append(b.m.segments, sourceSegment{b.lines + 1, count, pathName, fileLine})
+	b.source += code
+	b.lines += count
+}
+
+// Append code built elsewhere, with its map.
+func (b *sourceBuilder) addBuilt(other *sourceBuilder) {
+	for _, seg := range other.m.segments {
+		seg.startLine += b.lines
+		b.m.segments = append(b.m.segments, seg)
+	}
+	b.source += other.source
+	b.lines += other.lines
+}
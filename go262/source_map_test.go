@@ -0,0 +1,57 @@
+/*
+ * Copyright (c) 2017 Crimson AS <info@crimson.no>
+ * Author: Robin Burchell <robin.burchell@crimson.no>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package go262
+
+import (
+	"testing"
+)
+
+func TestSourceMapRewrite(t *testing.T) {
+	b := &sourceBuilder{}
+	b.add("\"use strict\";\n", "", 0)
+	b.add("a();\nb();\n", "harness/assert.js", 10)
+	b.add("c();\n", "test/built-ins/Foo/a.js", 20)
+
+	tests := []struct {
+		text     string
+		fileName string
+		expected string
+	}{
+		{"at /tmp/example1:2:5", "/tmp/example1", "at harness/assert.js:10:5"},
+		{"at (/tmp/example1:4)", "/tmp/example1", "at (test/built-ins/Foo/a.js:20)"},
+		{"file:///tmp/example1:3", "/tmp/example1", "harness/assert.js:11"},
+		{"at file:///tmp/example1:4:7", "/tmp/example1", "at test/built-ins/Foo/a.js:20:7"},
+		{"file:///home/go262/go262-test.js:3", "go262-test.js", "harness/assert.js:11"},
+		{"not-go262-test.js:3", "go262-test.js", "not-go262-test.js:3"},
+		{"/tmp/example1:1: SyntaxError", "/tmp/example1", "/tmp/example1:1: SyntaxError"},
+		{"/tmp/example12:2", "/tmp/example1", "/tmp/example12:2"},
+		{"/tmp/example1:2 /tmp/example1:4", "/tmp/example1", "harness/assert.js:10 test/built-ins/Foo/a.js:20"},
+		{"go262-test.js:3", "go262-test.js", "harness/assert.js:11"},
+	}
+	for _, test := range tests {
+		if got := b.m.rewrite(test.text, test.fileName); got != test.expected {
+			t.Errorf("rewrite(%q, %q) = %q, expected %q", test.text, test.fileName, got, test.expected)
+		}
+	}
+}
@@ -24,9 +24,11 @@
 package go262
 
 import (
+	"log"
 	"os"
 	"path"
 	"path/filepath"
+	"sync"
 )
 
 // A collection of test cases (.js files)
@@ -56,28 +58,49 @@ type GlobalState struct {
 	// The top-level directory "suite"
 	rootSuite *TestSuite
 
-	// Harness include cache.
-	// filename -> file content
-	includeCache map[string]string
+	// Harness include caches, one per engine as each can add its own.
+	// Engine -> includes
+	// These are read from workers while running jobs, and replaced when
+	// rescanning, so access them under includeLock.
+	includeCaches map[*Engine]*harnessIncludes
+	includeLock   sync.RWMutex
+
+	// Test sources, loaded on demand
+	sources *sourceCache
+
+	// Lock access to suiteMap, testMap and all suites, for rescanning. See
+	// RLock.
+	treeLock sync.RWMutex
+
+	// The path of the test262 checkout
+	rootPath string
 
 	// List of excluded test paths
 	excludeList []excludedCase
+
+	// The engine tests are run with
+	engine *Engine
+
+	// Other engines jobs are run with (see AddEngine), and the one results
+	// are compared with, if any (see SetReferenceEngine)
+	others    []*Engine
+	reference *Engine
+
+	// Recorded runs
+	history historyState
 }
 
-// Create all test cases and suites for a given path, returning the global state
-// for use elsewhere (e.g. Go262Web)
-func RecursivelyWalk(pathName string) *GlobalState {
-	state := &GlobalState{
-		make(map[string]*TestSuite),
-		make(map[string]*TestCase),
-		nil,
-		make(map[string]string),
-		nil,
-	}
+// Create all test cases and suites for a given path, to be run with engine,
+// returning the global state for use elsewhere (e.g. Go262Web)
+func RecursivelyWalk(pathName string, engine *Engine) *GlobalState {
+	state := newGlobalState(pathName)
 
 	state.readExpectations()
 
-	filepath.Walk(pathName+"/harness", state.walkHarnessIncludes)
+	state.engine = engine
+	if err := state.readIncludeCaches(); err != nil {
+		log.Fatalf("Can't read the harness: %s", err.Error())
+	}
 
 	walkWrapper := func(pathName string, info os.FileInfo, err error) error {
 		return walkSuitesAndTests(state, pathName, info, err)
@@ -86,18 +109,27 @@ func RecursivelyWalk(pathName string) *GlobalState {
 	state.rootSuite = state.createSuiteIfNeeded(pathName)
 	filepath.Walk(pathName+"/test", walkWrapper)
 
-	suite := state.rootSuite
-	suite.parseRecursive()
+	state.parseAll()
+	state.readHistory()
 	return state
 }
 
-func (suite *TestSuite) parseRecursive() {
-	for _, t := range suite.Tests {
-		t.Parse()
-	}
-
-	for _, v := range suite.Suites {
-		v.parseRecursive()
+// Create an empty global state for the test262 checkout at pathName
+func newGlobalState(pathName string) *GlobalState {
+	return &GlobalState{
+		make(map[string]*TestSuite),
+		make(map[string]*TestCase),
+		nil,
+		nil,
+		sync.RWMutex{},
+		newSourceCache(DefaultSourceCacheSize),
+		sync.RWMutex{},
+		path.Clean(pathName),
+		nil,
+		nil,
+		nil,
+		nil,
+		historyState{},
 	}
 }
 
@@ -118,11 +150,24 @@ func walkSuitesAndTests(global *GlobalState, pathName string, info os.FileInfo,
 		if suite == nil {
 			panic("Can't find suite!?")
 		}
-		suite.createTestCase(pathName)
+		test := suite.createTestCase(pathName)
+		test.modTime = info.ModTime()
+		test.size = info.Size()
 	}
 	return nil
 }
 
+// Take a read lock on the suites and tests, so that they aren't changed
+// underneath you by a Rescan. Don't hold it while running jobs, or rescans will
+// be blocked until the jobs finish, and don't take it recursively.
+func (global *GlobalState) RLock() {
+	global.treeLock.RLock()
+}
+
+func (global *GlobalState) RUnlock() {
+	global.treeLock.RUnlock()
+}
+
 func (global *GlobalState) RootSuite() *TestSuite {
 	return global.rootSuite
 }
@@ -155,16 +200,17 @@ func (global *GlobalState) createSuiteIfNeeded(pathName string) *TestSuite {
 	return suite
 }
 
-// Returns a list of all jobs in this suite, recursively.
-func (suite *TestSuite) DetermineRunJobs() []*TestJob {
+// Returns a list of all jobs in this suite, recursively. Unless force is set,
+// jobs that are unchanged since their last result are skipped.
+func (suite *TestSuite) DetermineRunJobs(force bool) []*TestJob {
 	var jobs []*TestJob
 
 	for _, test := range suite.Tests {
-		jobs = append(jobs, test.DetermineRunJobs()...)
+		jobs = append(jobs, test.DetermineRunJobs(force)...)
 	}
 
 	for _, child := range suite.Suites {
-		jobs = append(jobs, child.DetermineRunJobs()...)
+		jobs = append(jobs, child.DetermineRunJobs(force)...)
 	}
 
 	return jobs
@@ -174,37 +220,76 @@ type SuiteResults struct {
 	// Total tests for a type (that are valid, and not excluded)
 	TotalCounts map[string]float64
 
-	// Total tests for a type that were successful in the last run
+	// Total tests for a type that were successful in the last run, without
+	// being flaky
 	SuccessCounts map[string]float64
 
+	// Total tests for a type that passed in the last run, but only after
+	// failing first
+	FlakyCounts map[string]float64
+
+	// Total tests for a type that failed in the last run
+	FailureCounts map[string]float64
+
 	// Total tests that are excluded
 	ExcludedCounts map[string]float64
+
+	// Total tests the engine can't run, for lack of $262 capabilities
+	UnsupportedCounts map[string]float64
 }
 
-// Get results for this suite
-func (suite *TestSuite) CalculateResults() SuiteResults {
-	r := SuiteResults{
+func newSuiteResults() SuiteResults {
+	return SuiteResults{
+		make(map[string]float64),
+		make(map[string]float64),
+		make(map[string]float64),
 		make(map[string]float64),
 		make(map[string]float64),
 		make(map[string]float64),
 	}
+}
 
-	for _, test := range suite.Tests {
-		calcForType := func(runType string, state string) {
-			if state == WillNotRunState {
-				r.ExcludedCounts[runType] += 1
-				return
-			}
+// Count the state of a test into the results
+func (r SuiteResults) addTest(test *TestCase) {
+	r.addTestWith(test, test.global.engine)
+}
+
+// Count the state of a test with an engine into the results
+func (r SuiteResults) addTestWith(test *TestCase, engine *Engine) {
+	calcForType := func(runType string, state string) {
+		if state == WillNotRunState {
+			r.ExcludedCounts[runType] += 1
+			return
+		} else if state == UnsupportedState {
+			// Neither a pass nor a failure of the engine
+			r.UnsupportedCounts[runType] += 1
+			return
+		}
 
-			r.TotalCounts[runType] += 1
+		r.TotalCounts[runType] += 1
 
-			if state == SuccessState {
-				r.SuccessCounts[runType] += 1
-			}
+		// Flaky tests did pass in the end, but shouldn't look like they
+		// reliably do
+		if state == SuccessState {
+			r.SuccessCounts[runType] += 1
+		} else if state == FlakyState {
+			r.FlakyCounts[runType] += 1
+		} else if state == FailureState {
+			r.FailureCounts[runType] += 1
 		}
+	}
+
+	for _, runType := range test.global.RunTypes() {
+		calcForType(runType, test.StateValueWith(engine, runType))
+	}
+}
+
+// Get results for this suite
+func (suite *TestSuite) CalculateResults() SuiteResults {
+	r := newSuiteResults()
 
-		calcForType("strict", test.StateValue("strict"))
-		calcForType("nonstrict", test.StateValue("nonstrict"))
+	for _, test := range suite.Tests {
+		r.addTest(test)
 	}
 
 	return r
@@ -212,10 +297,9 @@ func (suite *TestSuite) CalculateResults() SuiteResults {
 
 // ### track whether or not we have actually run tests, and return
 // HasNotRunState if we haven't run them
-func (suite *TestSuite) StateValue(runType string) string {
-	r := suite.CalculateResults()
+func (r SuiteResults) StateValue(runType string) string {
 	if r.TotalCounts[runType] == 0 {
-		if r.ExcludedCounts[runType] > 0 {
+		if r.ExcludedCounts[runType] > 0 || r.UnsupportedCounts[runType] > 0 {
 			return WillNotRunState
 		}
 		return HasNotRunState
@@ -223,9 +307,13 @@ func (suite *TestSuite) StateValue(runType string) string {
 
 	if r.SuccessCounts[runType] == r.TotalCounts[runType] {
 		return SuccessState
-	} else if r.SuccessCounts[runType] >= r.TotalCounts[runType]/2 {
+	} else if r.SuccessCounts[runType]+r.FlakyCounts[runType] >= r.TotalCounts[runType]/2 {
 		return PartialSuccessState
 	}
 
 	return FailureState
 }
+
+func (suite *TestSuite) StateValue(runType string) string {
+	return suite.CalculateResults().StateValue(runType)
+}
@@ -0,0 +1,131 @@
+/*
+ * Copyright (c) 2017 Crimson AS <info@crimson.no>
+ * Author: Robin Burchell <robin.burchell@crimson.no>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package go262
+
+import (
+	"errors"
+	"strings"
+)
+
+// A configuration of an engine besides its default one, e.g. with the JIT
+// disabled. Jobs are run once more per variant, and the results recorded
+// under run types of their own, like "strict:no-jit".
+type EngineVariant struct {
+	// A name for the configuration, e.g. no-jit
+	Name string
+
+	// Arguments passed after the engine's own
+	Args []string
+}
+
+// Separates the mode from the variant in a run type
+const variantSeparator = ":"
+
+// The modes a test can be run in, in the default configuration
+var baseRunTypes = []string{"strict", "nonstrict"}
+
+// Splits a run type into its mode ("strict" or "nonstrict") and the name of
+// its variant, which is empty for the engine's default configuration.
+func SplitRunType(runType string) (string, string) {
+	if i := strings.Index(runType, variantSeparator); i >= 0 {
+		return runType[:i], runType[i+len(variantSeparator):]
+	}
+	return runType, ""
+}
+
+// Make sure a variant name can be part of run types, and URLs showing them
+func checkVariantName(name string) error {
+	if len(name) == 0 {
+		return errors.New("a variant has no name")
+	} else if strings.ContainsAny(name, variantSeparator+"/?#") {
+		return errors.New("variant " + name + " has a name with one of :/?# in it")
+	}
+	return nil
+}
+
+// Returns the variant called name, or nil.
+func (engine *Engine) Variant(name string) *EngineVariant {
+	for i := range engine.Variants {
+		if engine.Variants[i].Name == name {
+			return &engine.Variants[i]
+		}
+	}
+	return nil
+}
+
+// Returns the run types of each of the engine's configurations: strict and
+// nonstrict, and then those of every variant.
+func (engine *Engine) RunTypes() []string {
+	runTypes := append([]string{}, baseRunTypes...)
+	for _, variant := range engine.Variants {
+		for _, mode := range baseRunTypes {
+			runTypes = append(runTypes, mode+variantSeparator+variant.Name)
+		}
+	}
+	return runTypes
+}
+
+// Whether the engine has the configuration a run type needs
+func (engine *Engine) hasRunType(runType string) bool {
+	_, variant := SplitRunType(runType)
+	return len(variant) == 0 || engine.Variant(variant) != nil
+}
+
+// Returns the hash the results of a run type are kept with: the engine's (see
+// Hash), and for a variant, that of its arguments too. Changing one variant
+// then only invalidates its own results.
+func (engine *Engine) runTypeHash(runType string) string {
+	hash := engine.Hash()
+	_, name := SplitRunType(runType)
+	variant := engine.Variant(name)
+	if len(hash) == 0 || variant == nil {
+		return hash
+	}
+	return hashSource(hash + "\x00" + strings.Join(variant.Args, "\x00"))
+}
+
+// Returns the run types jobs are run in: those of the main engine. Other
+// engines only run those of their variants with the same names.
+func (global *GlobalState) RunTypes() []string {
+	return global.engine.RunTypes()
+}
+
+// Parses variants given like "jit=--jit;no-jit=--no-jit --no-osr": each is a
+// name, and the space separated arguments it adds.
+func ParseVariants(spec string) ([]EngineVariant, error) {
+	var variants []EngineVariant
+	for _, part := range strings.Split(spec, ";") {
+		kv := strings.SplitN(part, "=", 2)
+		name := strings.TrimSpace(kv[0])
+		if err := checkVariantName(name); err != nil {
+			return nil, err
+		}
+		variant := EngineVariant{name, nil}
+		if len(kv) > 1 {
+			variant.Args = strings.Fields(kv[1])
+		}
+		variants = append(variants, variant)
+	}
+	return variants, nil
+}
@@ -0,0 +1,218 @@
+/*
+ * Copyright (c) 2017 Crimson AS <info@crimson.no>
+ * Author: Robin Burchell <robin.burchell@crimson.no>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package go262
+
+import (
+	"log"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// Rerun only tests whose last result was a failure
+const WatchFailing = "failing"
+
+// How long changes must stop for before a Watcher reruns tests by default
+const DefaultWatchSettle = 500 * time.Millisecond
+
+// A Watcher reruns a selection of tests whenever the engine executable
+// changes, and optionally whenever tests in the test262 tree change.
+type Watcher struct {
+	// What to rerun: WatchFailing, or the path of a suite or test
+	Selection string
+
+	// Whether to watch the test262 tree for changed tests too. The tree is
+	// rescanned (see Rescan), and added or changed tests are rerun.
+	WatchTree bool
+
+	// How often to check for changes
+	Interval time.Duration
+
+	// How long changes must stop for before rerunning, so an engine that is
+	// still being written, or a checkout touching many files, causes only
+	// one rerun, once it is done
+	Settle time.Duration
+
+	// How many times to rerun failing jobs (see JobQueue.Retries)
+	Retries int
+
+	global *GlobalState
+	pool   *WorkerPool
+
+	// The engine hash we last ran with
+	engineHash string
+}
+
+func NewWatcher(global *GlobalState, pool *WorkerPool, selection string) *Watcher {
+	return &Watcher{
+		selection,
+		false,
+		2 * time.Second,
+		DefaultWatchSettle,
+		0,
+		global,
+		pool,
+		"",
+	}
+}
+
+// Watch for changes forever, rerunning the selection on each of them.
+func (watcher *Watcher) Watch() {
+	watcher.engineHash = watcher.global.engine.Hash()
+
+	log.Printf("Watching %s to rerun %s", watcher.global.engine.Path, watcher.Selection)
+	for range time.Tick(watcher.Interval) {
+		engineChanged, changed, _ := watcher.detectChanges()
+		if !engineChanged && len(changed) == 0 {
+			continue
+		}
+
+		// Wait for the changes to settle, and for the engine to be there
+		changedNames := make(map[string]bool)
+		for {
+			for _, test := range changed {
+				changedNames[test.PathName] = true
+			}
+			time.Sleep(watcher.Settle)
+			moreEngine, more, ready := watcher.detectChanges()
+			changed = more
+			if !moreEngine && len(changed) == 0 && ready {
+				break
+			}
+			engineChanged = engineChanged || moreEngine
+		}
+
+		watcher.global.RLock()
+		jobs := watcher.selectJobs()
+		selected := make(map[string]bool)
+		for _, job := range jobs {
+			selected[job.TestCase.PathName+" "+job.RunType] = true
+		}
+		for pathName := range changedNames {
+			// Changed tests may have been replaced by later rescans, or
+			// removed
+			test := watcher.global.FetchTestcase(pathName)
+			if test == nil {
+				continue
+			}
+			for _, job := range test.DetermineRunJobs(false) {
+				if !selected[test.PathName+" "+job.RunType] {
+					jobs = append(jobs, job)
+				}
+			}
+		}
+		watcher.global.RUnlock()
+
+		watcher.run(jobs)
+	}
+}
+
+// Returns whether the engine changed since it was last checked, which tests
+// changed, if the tree is watched, and whether the engine can be run. While it
+// can't be hashed (e.g. it is missing while being rebuilt), it isn't ready,
+// and doesn't count as changed until it is back.
+func (watcher *Watcher) detectChanges() (bool, []*TestCase, bool) {
+	engineChanged := false
+	hash := watcher.global.engine.Hash()
+	ready := len(hash) > 0
+	if ready && hash != watcher.engineHash {
+		watcher.engineHash = hash
+		engineChanged = true
+	}
+
+	var changed []*TestCase
+	if watcher.WatchTree {
+		changed, _ = watcher.global.Rescan()
+	}
+	return engineChanged, changed, ready
+}
+
+// Returns the jobs for the selection. Jobs that didn't change since their last
+// result are skipped, so that only changes to the engine (or tests) cause a
+// rerun.
+func (watcher *Watcher) selectJobs() []*TestJob {
+	if watcher.Selection != WatchFailing {
+		pathName := filepath.Clean(watcher.Selection)
+		if suite := watcher.global.FetchSuite(pathName); suite != nil {
+			return suite.DetermineRunJobs(false)
+		} else if test := watcher.global.FetchTestcase(pathName); test != nil {
+			return test.DetermineRunJobs(false)
+		}
+		log.Printf("Nothing to watch at %s", pathName)
+		return nil
+	}
+
+	var jobs []*TestJob
+	for _, test := range watcher.global.testMap {
+		for _, job := range test.DetermineRunJobs(false) {
+			res := test.GetLastResultFor(job.RunType)
+			if res != nil && !res.IsSuccessful() {
+				jobs = append(jobs, job)
+			}
+		}
+	}
+	return jobs
+}
+
+// Runs the jobs, recording them in the history, and logs how the outcomes
+// differ from the previous results.
+func (watcher *Watcher) run(jobs []*TestJob) {
+	if len(jobs) == 0 {
+		return
+	}
+
+	previous := make(map[*TestJob]*TestResult)
+	for _, job := range jobs {
+		previous[job] = job.TestCase.GetLastResultFor(job.RunType)
+	}
+
+	log.Printf("Change detected, rerunning %d jobs", len(jobs))
+	run := watcher.global.StartRun()
+	q := NewJobQueue(watcher.pool)
+	q.Retries = watcher.Retries
+	go q.SendJobs(jobs)
+
+	var fixed, regressed []string
+	for result := range q.ResultChannel {
+		run.Record(result)
+		name := result.TestCase.PathName + " (" + result.RunType + ")"
+		prev := previous[result.TestJob]
+		if result.IsSuccessful() && (prev == nil || !prev.IsSuccessful()) {
+			fixed = append(fixed, name)
+		} else if !result.IsSuccessful() && len(result.Unsupported) == 0 && (prev == nil || prev.IsSuccessful()) {
+			regressed = append(regressed, name)
+		}
+	}
+	watcher.global.FinishRun(run)
+
+	sort.Strings(fixed)
+	sort.Strings(regressed)
+	log.Printf("Rerun done: %d now passing, %d now failing", len(fixed), len(regressed))
+	for _, name := range fixed {
+		log.Printf("  + %s", name)
+	}
+	for _, name := range regressed {
+		log.Printf("  - %s", name)
+	}
+}
@@ -36,18 +36,38 @@ import (
 type WorkerPool struct {
 	queueChan   chan *JobQueue
 	workerCount int
+
+	// How many workers' worth of capacity isn't taken by running jobs. Jobs
+	// running several agents take more than one (see TestJob.Weight), so
+	// they don't overload the machine. Access under slotCond.L.
+	freeSlots int
+	slotCond  *sync.Cond
+
+	// Held while waiting for slots, so that light jobs can't keep a heavy one
+	// waiting forever
+	acquireLock sync.Mutex
 }
 
 // The heart of the worker.
-func workerFunc(queueChan chan *JobQueue) {
+func workerFunc(pool *WorkerPool) {
 	// Take a jobqueue...
-	for queue := range queueChan {
+	for queue := range pool.queueChan {
 		// ... and perform all jobs on it, until it is closed. Let the queue
 		// know we are alive.
 		queue.wg.Add(1)
 
 		for job := range queue.jobchan {
-			tr := job.TestCase.Run(job)
+			slots := pool.acquire(job.Weight())
+			tr := job.TestCase.RunWithRetries(job, queue.Retries)
+			pool.release(slots)
+
+			// Every other engine's run takes slots of its own, so it
+			// waits its turn like any other job
+			for _, engine := range job.TestCase.global.others {
+				slots = pool.acquire(job.Weight())
+				job.TestCase.runOtherEngine(engine, job, queue.Retries)
+				pool.release(slots)
+			}
 			queue.ResultChannel <- tr // ... and send the results back
 		}
 
@@ -66,13 +86,44 @@ func NewWorkerPool() *WorkerPool {
 	p := &WorkerPool{
 		make(chan *JobQueue),
 		runtime.NumCPU() - 1,
+		0,
+		sync.NewCond(&sync.Mutex{}),
+		sync.Mutex{},
 	}
+	p.freeSlots = p.workerCount
 	for i := 0; i < p.workerCount; i++ {
-		go workerFunc(p.queueChan)
+		go workerFunc(p)
 	}
 	return p
 }
 
+// Wait until weight slots are free, and take them. Returns how many were
+// taken, which is never more than the pool has.
+func (pool *WorkerPool) acquire(weight int) int {
+	if weight > pool.workerCount {
+		weight = pool.workerCount
+	}
+
+	pool.acquireLock.Lock()
+	pool.slotCond.L.Lock()
+	for pool.freeSlots < weight {
+		pool.slotCond.Wait()
+	}
+	pool.freeSlots -= weight
+	pool.slotCond.L.Unlock()
+	pool.acquireLock.Unlock()
+
+	return weight
+}
+
+// Give back slots taken with acquire.
+func (pool *WorkerPool) release(slots int) {
+	pool.slotCond.L.Lock()
+	pool.freeSlots += slots
+	pool.slotCond.L.Unlock()
+	pool.slotCond.Broadcast()
+}
+
 // A job queue is a list of things to do
 type JobQueue struct {
 	// Ask a worker to take care of this job
@@ -89,6 +140,10 @@ type JobQueue struct {
 
 	// Synchronize to make sure all workers in the pool have stopped
 	wg sync.WaitGroup
+
+	// How many times to rerun failing jobs, to spot flaky tests. Set this
+	// before calling SendJobs.
+	Retries int
 }
 
 // Create a new job queue on a given pool
@@ -99,6 +154,7 @@ func NewJobQueue(pool *WorkerPool) *JobQueue {
 		make(chan int),
 		pool,
 		sync.WaitGroup{},
+		0,
 	}
 
 	return q
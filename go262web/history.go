@@ -0,0 +1,131 @@
+/*
+ * Copyright (c) 2017 Crimson AS <info@crimson.no>
+ * Author: Robin Burchell <robin.burchell@crimson.no>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package go262web
+
+import (
+	Go262 "../go262"
+	"fmt"
+	"html"
+	"strings"
+	"time"
+)
+
+// Returns HTML for the outcome of a test across the latest recorded runs,
+// newest first
+func printTestTimeline(test *Go262.TestCase) string {
+	buf := ""
+	history := globalState.History()
+	runTypes := globalState.RunTypes()
+
+	for i := len(history) - 1; i >= 0; i-- {
+		run := history[i]
+		cells := ""
+		ran := false
+		for _, runType := range runTypes {
+			result := run.ResultFor(test.PathName, runType)
+			ran = ran || result != nil
+			cells += presentHistoryResult(result)
+		}
+		if !ran {
+			continue
+		}
+
+		buf += "<tr>"
+		buf += fmt.Sprintf("<td>%s</td><td>%s</td>", run.Date.Format(time.RFC1123), html.EscapeString(run.EngineVersion))
+		buf += cells
+		buf += "</tr>"
+	}
+
+	if len(buf) == 0 {
+		return ""
+	}
+
+	header := "<tr><th>Date</th><th>Engine</th>"
+	for _, runType := range runTypes {
+		header += "<th>" + html.EscapeString(runTypeTitle(runType)) + "</th>"
+	}
+	return `<b>Timeline</b>:<table border="1">` + header + "</tr>" + buf + "</table>"
+}
+
+func presentHistoryResult(result *Go262.HistoryResult) string {
+	if result == nil {
+		return "<td></td>"
+	}
+	if len(result.Unsupported) > 0 {
+		return `<td bgcolor="gray">unsupported</td>`
+	} else if result.Flaky {
+		return fmt.Sprintf(`<td bgcolor="orange">flaky (%d attempts)</td>`, result.Attempts)
+	} else if result.Success {
+		return `<td bgcolor="green">true</td>`
+	}
+	return fmt.Sprintf(`<td bgcolor="red">false %s</td>`, html.EscapeString(result.ErrorType))
+}
+
+const chartWidth = 600
+const chartHeight = 150
+
+// The colours of the run types' lines in charts, in the order of RunTypes,
+// reused when there are more run types
+var chartColours = []string{"blue", "orange", "green", "purple", "brown", "teal"}
+
+// Returns an SVG chart of the pass percentage of a suite over the latest
+// recorded runs that included any of its tests.
+func printSuiteTrend(suite *Go262.TestSuite) string {
+	points := suite.History()
+	if len(points) == 0 {
+		return ""
+	}
+
+	line := func(runType string, colour string) string {
+		coords := ""
+		for i, p := range points {
+			x := 0
+			if len(points) > 1 {
+				x = i * chartWidth / (len(points) - 1)
+			}
+			perc := 0.0
+			if p.TotalCounts[runType] > 0 {
+				perc = p.SuccessCounts[runType] / p.TotalCounts[runType]
+			}
+			coords += fmt.Sprintf("%d,%d ", x, chartHeight-int(perc*chartHeight))
+		}
+		return fmt.Sprintf(`<polyline fill="none" stroke="%s" stroke-width="2" points="%s"/>`, colour, coords)
+	}
+
+	buf := "<h2>Pass percentage over time</h2>"
+	buf += fmt.Sprintf(`<svg width="%d" height="%d" style="border: 1px solid black">`, chartWidth, chartHeight)
+	var legend []string
+	for i, runType := range globalState.RunTypes() {
+		colour := chartColours[i%len(chartColours)]
+		buf += line(runType, colour)
+		legend = append(legend, fmt.Sprintf(`<span style="color: %s">%s</span>`, colour, html.EscapeString(runType)))
+	}
+	buf += "</svg><br>"
+	buf += fmt.Sprintf(`%s, %d runs from %s (%s) to %s (%s)`,
+		strings.Join(legend, " "),
+		len(points),
+		points[0].Run.Date.Format(time.RFC1123), html.EscapeString(points[0].Run.EngineVersion),
+		points[len(points)-1].Run.Date.Format(time.RFC1123), html.EscapeString(points[len(points)-1].Run.EngineVersion))
+	return buf
+}
@@ -0,0 +1,156 @@
+/*
+ * Copyright (c) 2017 Crimson AS <info@crimson.no>
+ * Author: Robin Burchell <robin.burchell@crimson.no>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package go262web
+
+import (
+	Go262 "../go262"
+	"fmt"
+	"html"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Returns the header rows of a table with a pass column per run type and
+// engine. With one engine, the columns aren't grouped.
+func engineColumnsHeader(firstColumn string) string {
+	engines := globalState.Engines()
+	runTypes := globalState.RunTypes()
+	passColumns := ""
+	for _, runType := range runTypes {
+		passColumns += fmt.Sprintf("<th>Pass %s</th>", html.EscapeString(runTypeTitle(runType)))
+	}
+	if len(engines) == 1 {
+		return fmt.Sprintf(`<tr><th>%s</th>%s</tr>`, firstColumn, passColumns)
+	}
+
+	buf := fmt.Sprintf(`<tr><th rowspan="2">%s</th>`, firstColumn)
+	for _, engine := range engines {
+		buf += fmt.Sprintf(`<th colspan="%d">%s</th>`, len(runTypes), html.EscapeString(engine.Name))
+	}
+	buf += "</tr><tr>"
+	for range engines {
+		buf += passColumns
+	}
+	buf += "</tr>"
+	return buf
+}
+
+// Returns a form to pick two engines, and list the tests passing with the
+// first but not the second.
+func comparisonForm(query url.Values) string {
+	engines := globalState.Engines()
+	if len(engines) < 2 {
+		return ""
+	}
+
+	selectEngine := func(name string) string {
+		buf := fmt.Sprintf(`<select name="%s">`, name)
+		for _, engine := range engines {
+			selected := ""
+			if engine.Name == query.Get(name) {
+				selected = " selected"
+			}
+			buf += fmt.Sprintf(`<option%s>%s</option>`, selected, html.EscapeString(engine.Name))
+		}
+		return buf + "</select>"
+	}
+
+	buf := fmt.Sprintf(`<form>Tests passing with %s but not with %s `, selectEngine("passes"), selectEngine("fails"))
+	buf += `<input type="submit" value="Compare"></form>`
+	return buf
+}
+
+// Returns a table of the tests in the suite (and its children) passing with
+// engine a but failing with engine b.
+func printComparison(suite *Go262.TestSuite, a *Go262.Engine, b *Go262.Engine) string {
+	var found []*Go262.TestCase
+	var collect func(suite *Go262.TestSuite)
+	collect = func(suite *Go262.TestSuite) {
+		for _, test := range suite.Tests {
+			if test.PassesOnlyWith(a, b) {
+				found = append(found, test)
+			}
+		}
+		for _, child := range suite.Suites {
+			collect(child)
+		}
+	}
+	collect(suite)
+
+	buf := fmt.Sprintf("%d tests pass with %s but not with %s.<br>", len(found), html.EscapeString(a.Name), html.EscapeString(b.Name))
+	buf += `<table border="1">` + engineColumnsHeader("Test")
+	for _, test := range found {
+		buf += testRow(test)
+	}
+	buf += "</table>"
+	return buf
+}
+
+// Handles the comparison filter of a suite page, if it was asked for. Returns
+// whether it did.
+func handleComparison(w http.ResponseWriter, r *http.Request, suite *Go262.TestSuite) bool {
+	query := r.URL.Query()
+	if len(query.Get("passes")) == 0 && len(query.Get("fails")) == 0 {
+		return false
+	}
+
+	a := globalState.EngineByName(query.Get("passes"))
+	b := globalState.EngineByName(query.Get("fails"))
+	if a == nil || b == nil {
+		errorHandler(w, r, http.StatusNotFound)
+		return true
+	}
+
+	buf := headerBreadcrumbSuiteLink(suite, "")
+	buf += comparisonForm(query)
+	buf += printComparison(suite, a, b)
+	w.Write([]byte(buf))
+	return true
+}
+
+// Returns how a run type is named in column headers, e.g. "Strict" or
+// "Nonstrict (no-jit)"
+func runTypeTitle(runType string) string {
+	mode, variant := Go262.SplitRunType(runType)
+	title := strings.ToUpper(mode[:1]) + mode[1:]
+	if len(variant) > 0 {
+		title += " (" + variant + ")"
+	}
+	return title
+}
+
+// Returns how the test did in the run types of the engine's variants, with
+// links to their logs and reproductions.
+func printVariants(test *Go262.TestCase) string {
+	buf := ""
+	for _, runType := range globalState.RunTypes() {
+		if _, variant := Go262.SplitRunType(runType); len(variant) == 0 || !test.HasRunType(runType) {
+			continue
+		}
+		buf += fmt.Sprintf("<b>%s</b>: %s", html.EscapeString(runTypeTitle(runType)), html.EscapeString(describeOutcome(test.GetLastResultFor(runType))))
+		buf += fmt.Sprintf(` - <a href="/read/%s/%s">View</a> <a href="/logs/%s/stderr/%s">Stderr</a> <a href="/logs/%s/stdout/%s">Stdout</a> <a href="/repro/%s/%s">Reproduce</a><br>`, runType, test.PathName, runType, test.PathName, runType, test.PathName, runType, test.PathName)
+	}
+	return buf
+}
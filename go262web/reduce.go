@@ -0,0 +1,101 @@
+/*
+ * Copyright (c) 2017 Crimson AS <info@crimson.no>
+ * Author: Robin Burchell <robin.burchell@crimson.no>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package go262web
+
+import (
+	Go262 "../go262"
+	"fmt"
+	"github.com/gorilla/mux"
+	"html"
+	"io"
+	"net/http"
+)
+
+// Returns the test and run type a reduction page is for, or nil if there is
+// no such test.
+func reductionTest(r *http.Request) (*Go262.TestCase, string) {
+	vars := mux.Vars(r)
+	runType := vars["runtype"]
+	test := globalState.FetchTestcase(vars["path"])
+	if test == nil || !test.HasRunType(runType) {
+		return nil, ""
+	}
+	return test, runType
+}
+
+// /reduce/<runtype>/<path> handler: reduces the failing test, reporting
+// progress as it goes.
+func reduceHandler(w http.ResponseWriter, r *http.Request) {
+	// Don't hold the lock while reducing, which takes a while
+	globalState.RLock()
+	test, runType := reductionTest(r)
+	globalState.RUnlock()
+	if test == nil {
+		errorHandler(w, r, http.StatusNotFound)
+		return
+	}
+
+	io.WriteString(w, fmt.Sprintf("Reducing %s (%s), running the engine at most %d times...\n", test.PathName, runType, Go262.MaxReductionRuns))
+	job := &Go262.TestJob{TestCase: test, RunType: runType}
+	red, err := test.Reduce(job, testRunnerPool, func(msg string) {
+		io.WriteString(w, " * "+msg+"\n")
+	})
+	if err != nil {
+		io.WriteString(w, "Can't reduce: "+err.Error()+"\n")
+		return
+	}
+
+	io.WriteString(w, fmt.Sprintf("Done after %d runs. See /reduction/%s/%s\n\n", red.Runs, runType, test.PathName))
+	io.WriteString(w, red.Reduced)
+}
+
+// /reduction/<runtype>/<path> handler: shows the last reduction of the test.
+func reductionHandler(w http.ResponseWriter, r *http.Request) {
+	test, runType := reductionTest(r)
+	if test == nil {
+		errorHandler(w, r, http.StatusNotFound)
+		return
+	}
+
+	red := test.LastReduction(runType)
+	if red == nil {
+		io.WriteString(w, fmt.Sprintf(`Not reduced yet. <a href="/reduce/%s/%s">Reduce it</a>`, runType, test.PathName))
+		return
+	}
+
+	s := headerBreadcrumbSuiteLink(test.Suites[0], "/"+test.FileName())
+	s += fmt.Sprintf("<b>Run type</b>: %s<br>", runType)
+	s += fmt.Sprintf("<b>Reduced</b>: %s, in %d runs<br>", red.Date.Format("2006-01-02 15:04:05"), red.Runs)
+	if len(red.ErrorType) > 0 {
+		s += fmt.Sprintf("<b>Still throws</b>: %s<br>", html.EscapeString(red.ErrorType+": "+red.ErrorMessage))
+	} else {
+		s += fmt.Sprintf("<b>Still exits successfully</b>: %t<br>", red.ExitSuccess)
+	}
+	s += fmt.Sprintf(`<b>Reduce again</b>: <a href="/reduce/%s/%s">Reduce</a><br>`, runType, test.PathName)
+	s += "<h2>Reduced</h2>"
+	s += printSource(red.Reduced, 1, nil)
+	s += "<h2>Original</h2>"
+	s += printSource(red.Original, test.DataLine(), nil)
+	io.WriteString(w, s)
+}
@@ -0,0 +1,91 @@
+/*
+ * Copyright (c) 2017 Crimson AS <info@crimson.no>
+ * Author: Robin Burchell <robin.burchell@crimson.no>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package go262web
+
+import (
+	Go262 "../go262"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+)
+
+// Returns the outcome of a result in words, for comparing engines.
+func describeOutcome(res *Go262.TestResult) string {
+	if res == nil {
+		return "not run"
+	} else if len(res.Unsupported) > 0 {
+		return "unsupported"
+	}
+
+	outcome := "fail"
+	if res.IsSuccessful() {
+		outcome = "pass"
+	}
+	if len(res.ErrorType) > 0 {
+		outcome += ", threw " + res.ErrorType
+	}
+	return outcome
+}
+
+// Returns the colour and text presenting how the reference engine did on a
+// test, highlighting disagreements with the engine.
+func presentReference(test *Go262.TestCase, runType string) (string, string) {
+	ref := test.GetReferenceResultFor(runType)
+	if ref == nil {
+		return "", ""
+	} else if test.Disagrees(runType) {
+		return "magenta", "disagrees"
+	} else if len(ref.Unsupported) > 0 {
+		return "gray", "unsupported"
+	} else if ref.IsSuccessful() {
+		return "green", "true"
+	}
+	return "red", "false"
+}
+
+// /disagreements handler
+func disagreementsHandler(w http.ResponseWriter, r *http.Request) {
+	reference := globalState.ReferenceEngine()
+	if reference == nil {
+		io.WriteString(w, "No reference engine is set (see -reference-engine).")
+		return
+	}
+
+	found := globalState.FindDisagreements()
+	buf := fmt.Sprintf("<h1>Disagreements with %s</h1>", html.EscapeString(reference.Name))
+	buf += fmt.Sprintf("%d jobs whose outcome differs between %s and %s.<br>", len(found), html.EscapeString(globalState.Engine().Name), html.EscapeString(reference.Name))
+	buf += `<table border="1"><tr><th>Test</th><th>Run type</th><th>Engine</th><th>Reference</th><th>Expected to</th></tr>`
+	for _, d := range found {
+		buf += "<tr>"
+		buf += fmt.Sprintf(`<td><a href="/test/%s">%s</a></td>`, d.Test.PathName, d.Test.PathName)
+		buf += fmt.Sprintf("<td>%s</td>", d.RunType)
+		buf += fmt.Sprintf("<td>%s</td>", html.EscapeString(describeOutcome(d.Result)))
+		buf += fmt.Sprintf("<td>%s</td>", html.EscapeString(describeOutcome(d.Reference)))
+		buf += fmt.Sprintf("<td>%s</td>", html.EscapeString(d.Test.ExpectedOutcome()))
+		buf += "</tr>"
+	}
+	buf += "</table>"
+	io.WriteString(w, buf)
+}
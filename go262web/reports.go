@@ -0,0 +1,198 @@
+/*
+ * Copyright (c) 2017 Crimson AS <info@crimson.no>
+ * Author: Robin Burchell <robin.burchell@crimson.no>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package go262web
+
+import (
+	Go262 "../go262"
+	"fmt"
+	"github.com/gorilla/mux"
+	"html"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"text/tabwriter"
+)
+
+// Returns pass, flaky, fail, excluded and unsupported cells for a run type
+func resultCountCells(r Go262.SuiteResults, runType string) string {
+	passPerc := ""
+	if r.TotalCounts[runType] > 0 {
+		passPerc = fmt.Sprintf(" (%.2f%%)", r.SuccessCounts[runType]/r.TotalCounts[runType]*100)
+	}
+	buf := fmt.Sprintf(`<td bgcolor="%s">%d%s</td>`, presentSuiteState(r.StateValue(runType)), int(r.SuccessCounts[runType]), passPerc)
+	buf += fmt.Sprintf(`<td>%d</td>`, int(r.FlakyCounts[runType]))
+	buf += fmt.Sprintf(`<td>%d</td>`, int(r.FailureCounts[runType]))
+	buf += fmt.Sprintf(`<td>%d</td>`, int(r.ExcludedCounts[runType]))
+	buf += fmt.Sprintf(`<td>%d</td>`, int(r.UnsupportedCounts[runType]))
+	return buf
+}
+
+// Returns the header rows of a table of results per run type
+func resultCountHeader(firstColumns ...string) string {
+	buf := "<tr>"
+	for _, col := range firstColumns {
+		buf += fmt.Sprintf(`<th rowspan="2">%s</th>`, col)
+	}
+	for _, runType := range globalState.RunTypes() {
+		buf += fmt.Sprintf(`<th colspan="5">%s</th>`, runType)
+	}
+	buf += "</tr><tr>"
+	for range globalState.RunTypes() {
+		buf += "<th>Pass</th><th>Flaky</th><th>Fail</th><th>Excluded</th><th>Unsupported</th>"
+	}
+	buf += "</tr>"
+	return buf
+}
+
+// /features handler
+func featuresHandler(w http.ResponseWriter, r *http.Request) {
+	buf := `<h1>Features</h1><a href="/features.txt">Plain text report</a>`
+	buf += `<table border="1">`
+	buf += resultCountHeader("Feature", "Tests")
+	for _, fr := range globalState.CalculateFeatureResults() {
+		buf += "<tr>"
+		buf += fmt.Sprintf("<td>%s</td><td>%d</td>", html.EscapeString(fr.Feature), fr.TestCount)
+		for _, runType := range globalState.RunTypes() {
+			buf += resultCountCells(fr.SuiteResults, runType)
+		}
+		buf += "</tr>"
+	}
+	buf += "</table>"
+	io.WriteString(w, buf)
+}
+
+// /features.txt handler
+func featuresReportHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprint(tw, "Feature\tTests")
+	for _, runType := range globalState.RunTypes() {
+		fmt.Fprintf(tw, "\t%s pass\t%s flaky\t%s fail\t%s excluded\t%s unsupported", runType, runType, runType, runType, runType)
+	}
+	fmt.Fprint(tw, "\n")
+	for _, fr := range globalState.CalculateFeatureResults() {
+		fmt.Fprintf(tw, "%s\t%d", fr.Feature, fr.TestCount)
+		for _, runType := range globalState.RunTypes() {
+			fmt.Fprintf(tw, "\t%d\t%d\t%d\t%d\t%d", int(fr.SuccessCounts[runType]), int(fr.FlakyCounts[runType]), int(fr.FailureCounts[runType]), int(fr.ExcludedCounts[runType]), int(fr.UnsupportedCounts[runType]))
+		}
+		fmt.Fprint(tw, "\n")
+	}
+	tw.Flush()
+}
+
+// /editions handler
+func editionsHandler(w http.ResponseWriter, r *http.Request) {
+	results := globalState.CalculateEditionResults()
+
+	buf := "<h1>Editions</h1>"
+	buf += "<h2>Tests introduced by each edition</h2>"
+	buf += `<table border="1">`
+	buf += resultCountHeader("Edition", "Tests")
+	for _, er := range results {
+		buf += "<tr>"
+		buf += fmt.Sprintf("<td>%s</td><td>%d</td>", er.Edition, er.TestCount)
+		for _, runType := range globalState.RunTypes() {
+			buf += resultCountCells(er.SuiteResults, runType)
+		}
+		buf += "</tr>"
+	}
+	buf += "</table>"
+
+	buf += "<h2>Full support up to and including each edition</h2>"
+	buf += `<table border="1">`
+	buf += resultCountHeader("Edition")
+	for _, er := range results {
+		if er.Edition == Go262.UndatedEdition {
+			continue
+		}
+		buf += "<tr>"
+		buf += fmt.Sprintf("<td>%s</td>", er.Edition)
+		for _, runType := range globalState.RunTypes() {
+			buf += resultCountCells(er.CumulativeResults, runType)
+		}
+		buf += "</tr>"
+	}
+	buf += "</table>"
+	io.WriteString(w, buf)
+}
+
+// A local copy of the spec HTML, to link sections to (if any)
+var specPath string
+
+// Set the path to a locally stored copy of the ECMA-262 HTML (e.g. index.html
+// from a build of tc39/ecma262). The section report links esids to it.
+func SetSpecPath(pathName string) {
+	specPath = pathName
+}
+
+// /sections handler
+func sectionsHandler(w http.ResponseWriter, r *http.Request) {
+	buf := "<h1>Spec sections</h1>"
+	buf += `<table border="1">`
+	buf += resultCountHeader("Section", "Id type", "Tests")
+	for _, sr := range globalState.CalculateSectionResults() {
+		section := html.EscapeString(sr.Section)
+		if sr.IdType == "esid" && len(specPath) > 0 {
+			section = fmt.Sprintf(`<a href="/spec/%s#%s">%s</a>`, path.Base(specPath), url.PathEscape(sr.Section), section)
+		}
+		buf += "<tr>"
+		buf += fmt.Sprintf("<td>%s</td><td>%s</td><td>%d</td>", section, sr.IdType, sr.TestCount)
+		for _, runType := range globalState.RunTypes() {
+			buf += resultCountCells(sr.SuiteResults, runType)
+		}
+		buf += "</tr>"
+	}
+	buf += "</table>"
+	io.WriteString(w, buf)
+}
+
+// /lint and /lint/<path> handler
+func lintHandler(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["path"]
+	if len(name) == 0 {
+		name = globalState.RootSuite().PathName + "/test"
+	}
+
+	// Only lint what is part of the suite
+	if suite := globalState.FetchSuite(name); suite != nil {
+		name = suite.PathName
+	} else if test := globalState.FetchTestcase(name); test != nil {
+		name = test.PathName
+	} else {
+		errorHandler(w, r, http.StatusNotFound)
+		return
+	}
+
+	problems := globalState.Lint(name)
+	buf := fmt.Sprintf("<h1>Lint %s</h1>", html.EscapeString(name))
+	buf += fmt.Sprintf("%d problems found<br>", len(problems))
+	buf += `<table border="1"><tr><th>Test</th><th>Line</th><th>Problem</th></tr>`
+	for _, problem := range problems {
+		buf += fmt.Sprintf(`<tr><td><a href="/test/%s">%s</a></td><td>%d</td><td>%s</td></tr>`,
+			problem.PathName, html.EscapeString(problem.PathName), problem.Line, html.EscapeString(problem.Message))
+	}
+	buf += "</table>"
+	io.WriteString(w, buf)
+}
@@ -27,6 +27,7 @@ import (
 	Go262 "../go262"
 	"fmt"
 	"github.com/gorilla/mux"
+	"html"
 	"io"
 	"log"
 	"net/http"
@@ -73,43 +74,50 @@ func breadcrumbSuiteLink(suite *Go262.TestSuite, finalPart string) string {
 	return buf
 }
 
-func summarizeSuite(suite *Go262.TestSuite) string {
-	r := suite.CalculateResults()
-	buf := ""
+// Returns the colour used to present the state of a group of tests
+func presentSuiteState(state string) string {
+	switch state {
+	case Go262.WillNotRunState:
+		return "black"
+	case Go262.HasNotRunState:
+		return ""
+	case Go262.PartialSuccessState:
+		return "yellow"
+	case Go262.SuccessState:
+		return "green"
+	case Go262.FailureState:
+		return "red"
+	}
+	return "blue"
+}
 
-	strictCountPerc := ""
-	if r.TotalCounts["strict"] > 0 {
-		succ := r.SuccessCounts["strict"]
-		tot := r.TotalCounts["strict"]
-		strictCountPerc = fmt.Sprintf("%.2f%% (%d of %d)", succ/tot*100, int(succ), int(tot))
-	}
-	nonStrictCountPerc := ""
-	if r.TotalCounts["nonstrict"] > 0 {
-		succ := r.SuccessCounts["nonstrict"]
-		tot := r.TotalCounts["nonstrict"]
-		nonStrictCountPerc = fmt.Sprintf("%.2f%% (%d of %d)", succ/tot*100, int(succ), int(tot))
-	}
-	presentState := func(state string) string {
-		switch state {
-		case Go262.WillNotRunState:
-			return "black"
-		case Go262.HasNotRunState:
-			return ""
-		case Go262.PartialSuccessState:
-			return "yellow"
-		case Go262.SuccessState:
-			return "green"
-		case Go262.FailureState:
-			return "red"
-		}
-		return "blue"
+// Returns the pass percentage of a run type, how many tests it is of, and how
+// many more passed only after failing
+func passPercentage(r Go262.SuiteResults, runType string) string {
+	if r.TotalCounts[runType] == 0 {
+		return ""
+	}
+	succ := r.SuccessCounts[runType]
+	tot := r.TotalCounts[runType]
+	buf := fmt.Sprintf("%.2f%% (%d of %d)", succ/tot*100, int(succ), int(tot))
+	if flaky := r.FlakyCounts[runType]; flaky > 0 {
+		buf += fmt.Sprintf(", %d flaky", int(flaky))
 	}
+	return buf
+}
+
+func summarizeSuite(suite *Go262.TestSuite) string {
+	buf := ""
 
 	if len(suite.Tests) > 0 {
 		buf += "<tr>"
 		buf += fmt.Sprintf(`<td>%s</td>`, breadcrumbSuiteLink(suite, ""))
-		buf += fmt.Sprintf(`<td bgcolor="%s">%s</td>`, presentState(suite.StateValue("strict")), strictCountPerc)
-		buf += fmt.Sprintf(`<td bgcolor="%s">%s</td>`, presentState(suite.StateValue("nonstrict")), nonStrictCountPerc)
+		for _, engine := range globalState.Engines() {
+			r := suite.CalculateResultsWith(engine)
+			for _, runType := range globalState.RunTypes() {
+				buf += fmt.Sprintf(`<td bgcolor="%s">%s</td>`, presentSuiteState(r.StateValue(runType)), passPercentage(r, runType))
+			}
+		}
 		buf += "</tr>"
 	}
 
@@ -120,37 +128,59 @@ func summarizeSuite(suite *Go262.TestSuite) string {
 	return buf
 }
 
-func summarizeSuitesAndEverything(suite *Go262.TestSuite) string {
-	buf := ""
-	r := suite.CalculateResults()
-	for _, test := range suite.Tests {
-		buf += "<tr>"
-		buf += fmt.Sprintf(`<td><a href="/test/%s" title="%ss">%s</a></td>`, test.PathName, test.Metadata.Description, test.FileName())
-
-		presentState := func(state string) (string, string) {
-			switch state {
-			case Go262.WillNotRunState:
-				return "black", ""
-			case Go262.HasNotRunState:
-				return "", ""
-			case Go262.SuccessState:
-				return "green", "true"
-			case Go262.FailureState:
-				return "red", "false"
+// Returns the colour and text used to present the state of a test
+func presentTestState(state string) (string, string) {
+	switch state {
+	case Go262.WillNotRunState:
+		return "black", ""
+	case Go262.HasNotRunState:
+		return "", ""
+	case Go262.SuccessState:
+		return "green", "true"
+	case Go262.FailureState:
+		return "red", "false"
+	case Go262.FlakyState:
+		return "orange", "flaky"
+	case Go262.UnsupportedState:
+		return "gray", "unsupported"
+	}
+	return "blue", "WTF"
+}
+
+// Returns a table row with the state of a test with each engine
+func testRow(test *Go262.TestCase) string {
+	buf := "<tr>"
+	buf += fmt.Sprintf(`<td><a href="/test/%s" title="%ss">%s</a></td>`, test.PathName, test.Metadata.Description, test.FileName())
+
+	for _, engine := range globalState.Engines() {
+		for _, runType := range globalState.RunTypes() {
+			var col, text string
+			if engine == globalState.ReferenceEngine() {
+				col, text = presentReference(test, runType)
+			} else {
+				col, text = presentTestState(test.StateValueWith(engine, runType))
 			}
-			return "blue", "WTF"
+			buf += fmt.Sprintf(`<td bgcolor="%s">%s</td>`, col, text)
 		}
+	}
+	buf += "</tr>"
+	return buf
+}
 
-		strictCol, strictSuccess := presentState(test.StateValue("strict"))
-		nonStrictCol, nonStrictSuccess := presentState(test.StateValue("nonstrict"))
-
-		buf += fmt.Sprintf(`<td bgcolor="%s">%s</td>`, strictCol, strictSuccess)
-		buf += fmt.Sprintf(`<td bgcolor="%s">%s</td>`, nonStrictCol, nonStrictSuccess)
-		buf += "</tr>"
+func summarizeSuitesAndEverything(suite *Go262.TestSuite) string {
+	buf := ""
+	for _, test := range suite.Tests {
+		buf += testRow(test)
 	}
 
-	buf += `<tr><th>Test</th><th>Pass Strict</th><th>Pass Nonstrict</th></tr>`
-	buf += fmt.Sprintf(`<tr><th></th><th>%.2f%%</th><th>%.2f%%</th></tr>`, r.SuccessCounts["strict"]/r.TotalCounts["strict"]*100, r.SuccessCounts["nonstrict"]/r.TotalCounts["nonstrict"]*100)
+	totals := `<tr><th></th>`
+	for _, engine := range globalState.Engines() {
+		r := suite.CalculateResultsWith(engine)
+		for _, runType := range globalState.RunTypes() {
+			totals += fmt.Sprintf(`<th>%.2f%%</th>`, r.SuccessCounts[runType]/r.TotalCounts[runType]*100)
+		}
+	}
+	buf += engineColumnsHeader("Test") + totals + "</tr>"
 
 	return buf
 }
@@ -160,7 +190,7 @@ func printSuite(suite *Go262.TestSuite, printHeaderIfEmpty bool) string {
 	buf := ""
 
 	if printHeaderIfEmpty || len(suite.Tests) > 0 {
-		runPart := fmt.Sprintf(` - <a href="/run/%s">Run</a>`, suite.PathName)
+		runPart := fmt.Sprintf(` - <a href="/run/%s">Run</a> - <a href="/run/%s?force=1">Force run</a> - <a href="/lint/%s">Lint</a>`, suite.PathName, suite.PathName, suite.PathName)
 		if !suite.IsExcluded() {
 			runPart += fmt.Sprintf(` - <a href="/exclude/true/%s">Exclude</a>`, suite.PathName)
 		} else {
@@ -171,11 +201,12 @@ func printSuite(suite *Go262.TestSuite, printHeaderIfEmpty bool) string {
 
 	if printHeaderIfEmpty && len(suite.Tests) == 0 {
 		// Summarize all suites in here recursively
-		buf += `<table border="1"><th>Suite</th><th>Pass Strict</th><th>Pass Nonstrict</th>`
+		buf += comparisonForm(nil)
+		buf += `<table border="1">` + engineColumnsHeader("Suite")
 		buf += summarizeSuite(suite)
 		buf += `</table>`
 	} else if len(suite.Tests) > 0 {
-		buf += `<table border="1"><th>Test</th><th>Pass Strict</th><th>Pass Nonstrict</th>`
+		buf += `<table border="1">` + engineColumnsHeader("Test")
 		buf += summarizeSuitesAndEverything(suite)
 		buf += "</table>"
 
@@ -189,7 +220,12 @@ func printSuite(suite *Go262.TestSuite, printHeaderIfEmpty bool) string {
 
 // / handler
 func indexHandler(w http.ResponseWriter, r *http.Request) {
+	if handleComparison(w, r, globalState.RootSuite()) {
+		return
+	}
+	io.WriteString(w, `<a href="/features">Features</a> - <a href="/editions">Editions</a> - <a href="/sections">Spec sections</a> - <a href="/lint">Lint</a> - <a href="/disagreements">Disagreements</a> - <a href="/rescan">Rescan test262</a><br>`)
 	io.WriteString(w, printSuite(globalState.RootSuite(), true))
+	io.WriteString(w, printSuiteTrend(globalState.RootSuite()))
 }
 
 // /suite/<path> handler
@@ -201,8 +237,20 @@ func suiteShowHandler(w http.ResponseWriter, r *http.Request) {
 		errorHandler(w, r, http.StatusNotFound)
 		return
 	}
+	if handleComparison(w, r, suite) {
+		return
+	}
 
 	io.WriteString(w, printSuite(suite, true))
+	io.WriteString(w, printSuiteTrend(suite))
+}
+
+// Describes what a result threw, if anything
+func thrownError(result *Go262.TestResult) string {
+	if result == nil || len(result.ErrorType) == 0 {
+		return ""
+	}
+	return html.EscapeString(result.ErrorType + ": " + result.ErrorMessage)
 }
 
 // Prints information about a specific test
@@ -219,9 +267,47 @@ func printTest(test *Go262.TestCase) []byte {
 	s += fmt.Sprintf("<b>Author</b>: %s<br>", test.Metadata.Author)
 	s += fmt.Sprintf("<b>Flags</b>: %s<br>", test.Metadata.Flags)
 	s += fmt.Sprintf("<b>Features</b>: %s<br>", test.Metadata.Features)
+	includes, err := test.ResolveIncludes()
+	if err != nil {
+		s += fmt.Sprintf("<b>Includes</b>: %s<br>", html.EscapeString(err.Error()))
+	} else {
+		s += "<b>Includes</b>:"
+		for _, inc := range includes {
+			s += fmt.Sprintf(` <a href="%s" title="%s">%s</a>`, harnessLink(inc.PathName), html.EscapeString(inc.PathName), html.EscapeString(inc.Name))
+		}
+		s += "<br>"
+	}
+	if capabilities := test.HostCapabilities(); len(capabilities) > 0 {
+		s += fmt.Sprintf("<b>Needs $262</b>: %s<br>", strings.Join(capabilities, ", "))
+	}
+	if missing := test.UnsupportedRequirements(); len(missing) > 0 {
+		s += fmt.Sprintf("<b>Unsupported by the engine</b>: %s<br>", html.EscapeString(strings.Join(missing, ", ")))
+	}
 	s += fmt.Sprintf(`<b>View Full</b>: <a href="/read/strict/%s">View Strict</a> <a href="/read/nonstrict/%s">View Non-strict</a><br>`, test.PathName, test.PathName)
+	s += fmt.Sprintf(`<b>Reproduce</b>: <a href="/repro/strict/%s">Strict</a> <a href="/repro/nonstrict/%s">Non-strict</a><br>`, test.PathName, test.PathName)
+	s += fmt.Sprintf(`<b>Reduce</b>: <a href="/reduce/strict/%s">Strict</a> <a href="/reduce/nonstrict/%s">Non-strict</a> (last: <a href="/reduction/strict/%s">strict</a>, <a href="/reduction/nonstrict/%s">non-strict</a>)<br>`, test.PathName, test.PathName, test.PathName, test.PathName)
 	s += fmt.Sprintf(`<b>View Last Strict Logs</b>: <a href="/logs/strict/stderr/%s">Stderr</a> <a href="/logs/strict/stdout/%s">Stdout</a><br>`, test.PathName, test.PathName)
 	s += fmt.Sprintf(`<b>View Last NonStrict Logs</b>: <a href="/logs/nonstrict/stderr/%s">Stderr</a> <a href="/logs/nonstrict/stdout/%s">Stdout</a><br>`, test.PathName, test.PathName)
+	s += fmt.Sprintf("<b>Last Strict Thrown</b>: %s<br>", thrownError(test.GetLastResultFor("strict")))
+	s += fmt.Sprintf("<b>Last NonStrict Thrown</b>: %s<br>", thrownError(test.GetLastResultFor("nonstrict")))
+	s += printVariants(test)
+	if reference := globalState.ReferenceEngine(); reference != nil {
+		for _, runType := range globalState.RunTypes() {
+			if !test.HasRunType(runType) {
+				continue
+			}
+			s += fmt.Sprintf("<b>Reference (%s) %s</b>: %s", html.EscapeString(reference.Name), runType, html.EscapeString(describeOutcome(test.GetReferenceResultFor(runType))))
+			if test.Disagrees(runType) {
+				s += ` <span style="background-color: magenta">disagrees</span>`
+			}
+			s += "<br>"
+		}
+	}
+	var flakiness []string
+	for _, runType := range globalState.RunTypes() {
+		flakiness = append(flakiness, fmt.Sprintf("%s %.0f%%", runType, globalState.FlakinessScore(test.PathName, runType)*100))
+	}
+	s += fmt.Sprintf("<b>Flakiness</b>: %s<br>", html.EscapeString(strings.Join(flakiness, ", ")))
 
 	if test.IsExcluded() {
 		s += fmt.Sprintf(`<b>Unexclude</b>: <a href="/exclude/false/%s">Unexclude</a><br>`, test.PathName)
@@ -229,8 +315,9 @@ func printTest(test *Go262.TestCase) []byte {
 		s += fmt.Sprintf(`<b>Exclude</b>: <a href="/exclude/true/%s">Exclude</a><br>`, test.PathName)
 	}
 
-	s += fmt.Sprintf(`<b>Run</b>: <a href="/run/%s">Run</a><br>`, test.PathName)
-	s += fmt.Sprintf("<pre>%s</pre>", test.TestData)
+	s += fmt.Sprintf(`<b>Run</b>: <a href="/run/%s">Run</a> <a href="/run/%s?force=1">Force run</a><br>`, test.PathName, test.PathName)
+	s += printTestTimeline(test)
+	s += printSource(test.TestData(), test.DataLine(), failingLines(test))
 	// flags?
 	// features?
 	return []byte(s)
@@ -249,7 +336,15 @@ func testShowHandler(w http.ResponseWriter, r *http.Request) {
 	w.Write(printTest(test))
 }
 
-var testRunnerPool = Go262.NewWorkerPool()
+var testRunnerPool *Go262.WorkerPool
+
+// How many times failing jobs are rerun
+var retries int
+
+// Set how many times failing jobs are rerun, to spot flaky tests.
+func SetRetries(count int) {
+	retries = count
+}
 
 func runTestJobs(w http.ResponseWriter, jobs []*Go262.TestJob) {
 	notify := w.(http.CloseNotifier).CloseNotify()
@@ -258,6 +353,7 @@ func runTestJobs(w http.ResponseWriter, jobs []*Go262.TestJob) {
 
 	// Create a new queue of jobs to run, push our jobs to it.
 	q := Go262.NewJobQueue(testRunnerPool)
+	q.Retries = retries
 	go q.SendJobs(jobs)
 
 	go func() {
@@ -267,15 +363,30 @@ func runTestJobs(w http.ResponseWriter, jobs []*Go262.TestJob) {
 		q.Cancel()
 	}()
 
+	run := globalState.StartRun()
+	defer globalState.FinishRun(run)
+
 	io.WriteString(w, fmt.Sprintf("Running jobs, %d in queue...\n", len(jobs)))
 	for result := range q.ResultChannel {
-		if !result.IsSuccessful() {
+		run.Record(result)
+		if result.Flaky {
+			io.WriteString(w, fmt.Sprintf(" * Job %s(type: %s) is flaky, passed after %d attempts\n", result.TestCase.FileName(), result.RunType, len(result.Attempts)))
+		}
+		if result.TestCase.Disagrees(result.RunType) {
+			io.WriteString(w, fmt.Sprintf(" * Job %s(type: %s) disagrees with the reference engine: %s here, %s there\n", result.TestCase.FileName(), result.RunType, describeOutcome(result), describeOutcome(result.TestCase.GetReferenceResultFor(result.RunType))))
+		}
+		if len(result.Unsupported) > 0 {
+			io.WriteString(w, fmt.Sprintf(" * Job %s(type: %s) is unsupported, the engine lacks %s\n", result.TestCase.FileName(), result.RunType, strings.Join(result.Unsupported, ", ")))
+		} else if !result.IsSuccessful() {
 			io.WriteString(w, fmt.Sprintf(" * Job %s(type: %s) finished in %s unsuccessfully!\n", result.TestCase.FileName(), result.RunType, result.ExecutionDuration.String()))
 			if result.TestCase.IsNegative() {
 				io.WriteString(w, fmt.Sprintf("\t### expected to fail in %s (with type %s), but didn't\n", result.TestCase.Metadata.Negative.Phase, result.TestCase.Metadata.Negative.Type))
 			} else {
 				io.WriteString(w, fmt.Sprintf("\t### expected to pass, but failed\n"))
 			}
+			if len(result.ErrorType) > 0 {
+				io.WriteString(w, fmt.Sprintf("\t### threw %s: %s\n", result.ErrorType, result.ErrorMessage))
+			}
 			if len(result.StderrOutput) > 0 {
 				io.WriteString(w, "\t=== stderr ===\n")
 				for _, line := range strings.Split(result.StderrOutput, "\n") {
@@ -299,25 +410,35 @@ func runTestJobs(w http.ResponseWriter, jobs []*Go262.TestJob) {
 }
 
 // /run/<path> handler
+// Jobs unchanged since their last result are skipped, unless ?force=1 is given
 func runTestHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	name := vars["path"]
+	force := r.URL.Query().Get("force") == "1"
+
+	// Determine the jobs to send to the workers. Don't hold the lock while
+	// they run, or rescans would have to wait for them.
+	var jobs []*Go262.TestJob
+	globalState.RLock()
 	suite := globalState.FetchSuite(name)
 	if suite != nil {
-		jobs := suite.DetermineRunJobs()
-		runTestJobs(w, jobs)
-		return
+		jobs = suite.DetermineRunJobs(force)
 	} else {
 		test := globalState.FetchTestcase(name)
 		if test == nil {
+			globalState.RUnlock()
 			errorHandler(w, r, http.StatusNotFound)
 			return
 		}
 
-		// Determine the jobs to send to the workers, and send them
-		jobs := test.DetermineRunJobs()
-		runTestJobs(w, jobs)
+		jobs = test.DetermineRunJobs(force)
+	}
+	globalState.RUnlock()
+
+	if !force {
+		io.WriteString(w, "Skipping jobs unchanged since their last run (use ?force=1 to rerun them)\n")
 	}
+	runTestJobs(w, jobs)
 }
 
 // /read/{runtype}/<path>
@@ -333,12 +454,43 @@ func readCodeHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	j := Go262.TestJob{
-		test,
-		runType,
+		TestCase: test,
+		RunType:  runType,
+	}
+
+	files := test.GetSource(&j)
+	if len(files) == 1 {
+		io.WriteString(w, files[0].Source)
+		return
+	}
+	// Scripts run separately are shown one after the other, headed like
+	// tail does
+	for i, file := range files {
+		if i > 0 {
+			io.WriteString(w, "\n")
+		}
+		io.WriteString(w, "==> "+file.Name+" <==\n")
+		io.WriteString(w, file.Source)
+	}
+}
+
+// /repro/<runtype>/<path> handler
+func reproHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	runType := vars["runtype"]
+	name := vars["path"]
+
+	test := globalState.FetchTestcase(name)
+	if test == nil || !test.HasRunType(runType) {
+		errorHandler(w, r, http.StatusNotFound)
+		return
 	}
 
-	source := test.GetSource(&j)
-	io.WriteString(w, source)
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="repro-%s-%s.tar.gz"`, strings.TrimSuffix(test.FileName(), ".js"), runType))
+	if err := test.WriteRepro(&Go262.TestJob{TestCase: test, RunType: runType}, w); err != nil {
+		log.Printf("Can't write reproduction of %s: %s", name, err.Error())
+	}
 }
 
 // Sends customized error pages
@@ -357,6 +509,37 @@ func logReq(fn http.HandlerFunc) http.HandlerFunc {
 	}
 }
 
+// Holds a read lock on the suites and tests while handling the request, so a
+// rescan doesn't change them underneath us.
+func treeLocked(fn http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		globalState.RLock()
+		defer globalState.RUnlock()
+		fn(w, r)
+	}
+}
+
+// /rescan handler
+func rescanHandler(w http.ResponseWriter, r *http.Request) {
+	changed, err := globalState.Rescan()
+	if err != nil {
+		io.WriteString(w, fmt.Sprintf("Can't reread the harness, keeping the old one: %s\n", err.Error()))
+	}
+	io.WriteString(w, fmt.Sprintf("Rescanned, %d tests added or changed\n", len(changed)))
+	for _, test := range changed {
+		io.WriteString(w, fmt.Sprintf(" * %s\n", test.PathName))
+	}
+
+	globalState.RLock()
+	defer globalState.RUnlock()
+	if broken := globalState.BrokenTests(); len(broken) > 0 {
+		io.WriteString(w, fmt.Sprintf("%d tests are broken, and fail until fixed\n", len(broken)))
+		for _, test := range broken {
+			io.WriteString(w, fmt.Sprintf(" * %s: %s\n", test.PathName, test.IncludeError().Error()))
+		}
+	}
+}
+
 // /logs/{runtype}/{type}/<path>
 func readLogsHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
@@ -382,7 +565,8 @@ func readLogsHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if logType == "stderr" {
-		io.WriteString(w, res.StderrOutput)
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		io.WriteString(w, "<pre>"+linkSourcePositions(res.StderrOutput)+"</pre>")
 	} else {
 		io.WriteString(w, res.StdoutOutput)
 	}
@@ -454,17 +638,35 @@ func setExcludedHandler(w http.ResponseWriter, r *http.Request) {
 
 var globalState *Go262.GlobalState
 
-func Serve(state *Go262.GlobalState) {
+// Serve the web interface for state, running tests on pool.
+func Serve(state *Go262.GlobalState, pool *Go262.WorkerPool) {
 	globalState = state
+	testRunnerPool = pool
 
 	r := mux.NewRouter()
-	r.HandleFunc("/", logReq(indexHandler))
-	r.HandleFunc("/suite/{path:.+}", logReq(suiteShowHandler))
-	r.HandleFunc("/test/{path:.+}", logReq(testShowHandler))
+	r.HandleFunc("/", logReq(treeLocked(indexHandler)))
+	r.HandleFunc("/suite/{path:.+}", logReq(treeLocked(suiteShowHandler)))
+	r.HandleFunc("/test/{path:.+}", logReq(treeLocked(testShowHandler)))
 	r.HandleFunc("/run/{path:.+}", logReq(runTestHandler))
-	r.HandleFunc("/read/{runtype}/{path:.+}", logReq(readCodeHandler))
-	r.HandleFunc("/logs/{runtype}/{type}/{path:.+}", logReq(readLogsHandler))
-	r.HandleFunc("/exclude/{truefalse}/{path:.+}", logReq(setExcludedHandler))
+	r.HandleFunc("/read/{runtype}/{path:.+}", logReq(treeLocked(readCodeHandler)))
+	r.HandleFunc("/logs/{runtype}/{type}/{path:.+}", logReq(treeLocked(readLogsHandler)))
+	r.HandleFunc("/exclude/{truefalse}/{path:.+}", logReq(treeLocked(setExcludedHandler)))
+	r.HandleFunc("/reduce/{runtype}/{path:.+}", logReq(reduceHandler))
+	r.HandleFunc("/reduction/{runtype}/{path:.+}", logReq(treeLocked(reductionHandler)))
+	r.HandleFunc("/repro/{runtype}/{path:.+}", logReq(treeLocked(reproHandler)))
+	r.HandleFunc("/harness", logReq(treeLocked(harnessHandler)))
+	r.HandleFunc("/disagreements", logReq(treeLocked(disagreementsHandler)))
+	r.HandleFunc("/features", logReq(treeLocked(featuresHandler)))
+	r.HandleFunc("/features.txt", logReq(treeLocked(featuresReportHandler)))
+	r.HandleFunc("/editions", logReq(treeLocked(editionsHandler)))
+	r.HandleFunc("/sections", logReq(treeLocked(sectionsHandler)))
+	r.HandleFunc("/rescan", logReq(rescanHandler))
+	r.HandleFunc("/lint", logReq(treeLocked(lintHandler)))
+	r.HandleFunc("/lint/{path:.+}", logReq(treeLocked(lintHandler)))
+	if len(specPath) > 0 {
+		// Serve the whole directory, so the spec's stylesheets etc work too
+		r.PathPrefix("/spec/").Handler(http.StripPrefix("/spec/", http.FileServer(http.Dir(path.Dir(specPath)))))
+	}
 
 	s := &http.Server{
 		Addr:    ":8080",
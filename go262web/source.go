@@ -0,0 +1,125 @@
+/*
+ * Copyright (c) 2017 Crimson AS <info@crimson.no>
+ * Author: Robin Burchell <robin.burchell@crimson.no>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package go262web
+
+import (
+	Go262 "../go262"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Finds file:line positions in engine output, like those of stack traces
+var sourcePositionRegexp = regexp.MustCompile(`([\w./-]+\.js):(\d+)`)
+
+// Returns the page showing a harness file. The path is given as a query, as
+// preludes and shims may have absolute paths, which don't survive in the URL's
+// path.
+func harnessLink(pathName string) string {
+	return "/harness?path=" + url.QueryEscape(pathName)
+}
+
+// Returns the page showing a line of a test or harness file, or "" if the
+// file isn't one of those.
+func sourceLineLink(pathName string, line string) string {
+	if globalState.FetchTestcase(pathName) != nil {
+		return fmt.Sprintf("/test/%s#L%s", pathName, line)
+	}
+	if _, ok := globalState.HarnessSource(pathName); ok {
+		return harnessLink(pathName) + "#L" + line
+	}
+	return ""
+}
+
+// Returns engine output as HTML, with positions in test and harness files
+// linked to their lines.
+func linkSourcePositions(output string) string {
+	buf := ""
+	last := 0
+	for _, m := range sourcePositionRegexp.FindAllStringSubmatchIndex(output, -1) {
+		buf += html.EscapeString(output[last:m[0]])
+		pos := output[m[0]:m[1]]
+		if link := sourceLineLink(output[m[2]:m[3]], output[m[4]:m[5]]); len(link) > 0 {
+			buf += fmt.Sprintf(`<a href="%s">%s</a>`, link, html.EscapeString(pos))
+		} else {
+			buf += html.EscapeString(pos)
+		}
+		last = m[1]
+	}
+	return buf + html.EscapeString(output[last:])
+}
+
+// Returns the lines of a test the last failing results point at in their
+// stderr, e.g. the failing assertion.
+func failingLines(test *Go262.TestCase) map[int]bool {
+	lines := make(map[int]bool)
+	for _, runType := range globalState.RunTypes() {
+		res := test.GetLastResultFor(runType)
+		if res == nil || res.IsSuccessful() {
+			continue
+		}
+		for _, m := range sourcePositionRegexp.FindAllStringSubmatch(res.StderrOutput, -1) {
+			if m[1] == test.PathName {
+				line, _ := strconv.Atoi(m[2])
+				lines[line] = true
+				// The innermost position in the test is the interesting one
+				break
+			}
+		}
+	}
+	return lines
+}
+
+// Returns source as HTML, with numbered lines starting at firstLine, which can
+// be linked to as #L<line>. Lines in highlight are highlighted.
+func printSource(source string, firstLine int, highlight map[int]bool) string {
+	buf := "<pre>"
+	for i, text := range strings.Split(strings.TrimSuffix(source, "\n"), "\n") {
+		line := firstLine + i
+		style := ""
+		if highlight[line] {
+			style = ` style="background-color: #fbb"`
+		}
+		buf += fmt.Sprintf(`<span id="L%d"%s><a href="#L%d">%4d</a>  %s</span>`+"\n", line, style, line, line, html.EscapeString(text))
+	}
+	return buf + "</pre>"
+}
+
+// /harness?path=<path> handler
+func harnessHandler(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("path")
+	source, ok := globalState.HarnessSource(name)
+	if !ok {
+		errorHandler(w, r, http.StatusNotFound)
+		return
+	}
+
+	io.WriteString(w, fmt.Sprintf("<h1>%s</h1>", html.EscapeString(name)))
+	io.WriteString(w, printSource(source, 1, nil))
+}
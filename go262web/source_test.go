@@ -0,0 +1,75 @@
+/*
+ * Copyright (c) 2017 Crimson AS <info@crimson.no>
+ * Author: Robin Burchell <robin.burchell@crimson.no>
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ */
+
+package go262web
+
+import (
+	Go262 "../go262"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// An engine reporting positions as file:// URLs, like qmljs does, has them
+// rewritten to the test, linked, and highlighted.
+func TestFileURLPositions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "go262web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	cwd, _ := os.Getwd()
+	defer os.Chdir(cwd)
+	os.Chdir(dir)
+
+	files := map[string]string{
+		"test262/harness/sta.js":    "function Test262Error() {}\n",
+		"test262/harness/cth.js":    "\n",
+		"test262/harness/assert.js": "function assert() {}\n",
+		"test262/test/a.js":         "/*---\ndescription: fails\n---*/\nfoo();\nthrow new Test262Error();\n",
+		// Fails at the last line of the script it runs
+		"engine.sh": "#!/bin/sh\nfor f; do :; done\necho \"Uncaught Test262Error at file://$f:$(wc -l < \"$f\")\" >&2\nexit 1\n",
+	}
+	for name, contents := range files {
+		os.MkdirAll(filepath.Dir(name), 0755)
+		if err := ioutil.WriteFile(name, []byte(contents), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	globalState = Go262.RecursivelyWalk("test262", Go262.NewEngine(filepath.Join(dir, "engine.sh")))
+	test := globalState.FetchTestcase("test262/test/a.js")
+	res := test.Run(&Go262.TestJob{TestCase: test, RunType: "strict"})
+
+	if !strings.Contains(res.StderrOutput, " at test262/test/a.js:5\n") {
+		t.Errorf("Position not rewritten: %q", res.StderrOutput)
+	}
+	if link := `<a href="/test/test262/test/a.js#L5">test262/test/a.js:5</a>`; !strings.Contains(linkSourcePositions(res.StderrOutput), link) {
+		t.Errorf("%q not linked as %s", res.StderrOutput, link)
+	}
+	if lines := failingLines(test); len(lines) != 1 || !lines[5] {
+		t.Errorf("Failing lines are %v, want 5", lines)
+	}
+}
@@ -25,9 +25,168 @@ package main
 import (
 	Go262 "./go262"
 	Go262Web "./go262web"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
 )
 
+var enginePath = flag.String("engine", "/Users/burchr/code/qt/qtbase/bin/qmljs", "the JavaScript engine to run tests with")
+var engineVersionArgs = flag.String("engine-version-args", "", "space separated arguments that make the engine print its version")
+var retries = flag.Int("retries", 0, "how many times to rerun failing tests, to spot flaky ones")
+var watch = flag.String("watch", "", "rerun tests when the engine changes: \"failing\", or the path of a suite or test")
+var watchTree = flag.Bool("watch-tree", false, "with -watch, also rerun tests whose files change")
+var watchInterval = flag.Duration("watch-interval", 2*time.Second, "how often -watch checks for changes")
+var watchSettle = flag.Duration("watch-settle", Go262.DefaultWatchSettle, "how long changes must stop for before -watch reruns tests")
+var rescanInterval = flag.Duration("rescan-interval", 0, "how often to rescan test262 for changes (0 to only rescan on request)")
+var sourceCacheSize = flag.Int("source-cache-size", Go262.DefaultSourceCacheSize, "how many test sources to keep in memory")
+var lint = flag.String("lint", "", "lint the metadata of the tests at this path (a test, or a directory), print problems, and exit")
+var specPath = flag.String("spec", "", "path to a local copy of the ECMA-262 HTML, to link spec sections to")
+var errorPattern = flag.String("error-pattern", Go262.DefaultErrorPattern, "regular expression finding the uncaught exception type and message in stderr")
+var host262 = flag.String("host262", "", "how the engine provides $262: \"native\", \"none\", or the path of a shim to load before the harness (if empty, tests using $262 run anyway)")
+var hostCapabilities = flag.String("host-capabilities", "", "comma separated $262 capabilities the engine provides (all, if empty)")
+var agentShim = flag.String("agent-shim", "", "path of a shim implementing $262.agent with the engine's workers")
+var agentHook = flag.String("agent-hook", "", "path of a hook starting the engine's workers, on which go262 implements $262.agent (see go262/agent_protocol.go)")
+var mainCanBlock = flag.Bool("main-can-block", false, "whether the engine's main thread can block (e.g. in Atomics.wait) by default")
+var canBlockArgs = flag.String("can-block-args", "", "space separated arguments that let the main thread block, for CanBlockIsTrue tests")
+var cannotBlockArgs = flag.String("cannot-block-args", "", "space separated arguments that stop the main thread blocking, for CanBlockIsFalse tests")
+var separateScripts = flag.Bool("separate-scripts", false, "pass the harness and the test to the engine as separate script files, keeping the test's line numbers")
+var hostArgs = flag.String("host-args", "", "space separated arguments that start the engine as a persistent host running many tests (see go262/engine_host.go)")
+var hostTimeout = flag.Duration("host-timeout", Go262.DefaultHostTimeout, "how long a persistent host may take over a test before it is restarted")
+var variants = flag.String("variants", "", "other engine configurations to run every test in too, like \"jit=--jit;no-jit=--no-jit\"")
+var enginesFile = flag.String("engines", "", "YAML file of engine profiles; overrides -engine and the other engine flags")
+var engineProfile = flag.String("engine-profile", "", "with -engines, the name of the profile to use (the first one if empty)")
+var referenceEngine = flag.String("reference-engine", "", "a second JavaScript engine (e.g. node) to run tests with, and compare results against")
+var referenceProfile = flag.String("reference-profile", "", "with -engines, the name of the profile to compare results against")
+var compareProfiles = flag.String("compare-profiles", "", "with -engines, a comma separated list of other profiles to run tests with, and show side by side")
+
+// Returns the engine the flags ask for.
+func selectEngine() *Go262.Engine {
+	if len(*enginesFile) == 0 {
+		engine := Go262.NewEngine(*enginePath)
+		engine.VersionArgs = strings.Fields(*engineVersionArgs)
+		if err := engine.SetErrorPattern(*errorPattern); err != nil {
+			log.Fatalf("Bad -error-pattern: %s", err.Error())
+		}
+		engine.Host262 = *host262
+		if len(*hostCapabilities) > 0 {
+			engine.HostCapabilities = strings.Split(*hostCapabilities, ",")
+		}
+		engine.AgentShim = *agentShim
+		engine.AgentHook = *agentHook
+		engine.MainCanBlock = *mainCanBlock
+		if len(*canBlockArgs) > 0 {
+			engine.CanBlockArgs = strings.Fields(*canBlockArgs)
+		}
+		if len(*cannotBlockArgs) > 0 {
+			engine.CannotBlockArgs = strings.Fields(*cannotBlockArgs)
+		}
+		engine.SeparateScripts = *separateScripts
+		if len(*hostArgs) > 0 {
+			engine.HostArgs = strings.Fields(*hostArgs)
+		}
+		engine.HostTimeout = *hostTimeout
+		if len(*variants) > 0 {
+			var err error
+			engine.Variants, err = Go262.ParseVariants(*variants)
+			if err != nil {
+				log.Fatalf("Bad -variants: %s", err.Error())
+			}
+		}
+		return engine
+	}
+
+	return findProfile(*engineProfile)
+}
+
+// The profiles of the -engines file, once loaded. They are loaded only once,
+// so that a profile named by several flags is the same engine.
+var profiles []*Go262.Engine
+
+// Returns the engine profile called name from the -engines file, or the
+// first one if name is empty.
+func findProfile(name string) *Go262.Engine {
+	if len(*enginesFile) == 0 {
+		log.Fatalf("Engine profiles need -engines")
+	}
+	if profiles == nil {
+		var err error
+		profiles, err = Go262.LoadEngines(*enginesFile)
+		if err != nil {
+			log.Fatalf("Can't load engine profiles: %s", err.Error())
+		}
+	}
+	for _, engine := range profiles {
+		if len(name) == 0 || engine.Name == name {
+			return engine
+		}
+	}
+	log.Fatalf("No engine profile %q in %s", name, *enginesFile)
+	return nil
+}
+
+// Returns the engine to compare results against, if the flags ask for one.
+func selectReference() *Go262.Engine {
+	if len(*referenceProfile) > 0 {
+		return findProfile(*referenceProfile)
+	} else if len(*referenceEngine) > 0 {
+		return Go262.NewEngine(*referenceEngine)
+	}
+	return nil
+}
+
 func main() {
-	state := Go262.RecursivelyWalk("./test262")
-	Go262Web.Serve(state)
+	flag.Parse()
+
+	if len(*lint) > 0 {
+		problems, err := Go262.LintFiles("./test262", selectEngine(), *lint)
+		if err != nil {
+			log.Fatalf("Can't lint: %s", err.Error())
+		}
+		for _, problem := range problems {
+			fmt.Println(problem.String())
+		}
+		if len(problems) > 0 {
+			os.Exit(1)
+		}
+		return
+	}
+
+	state := Go262.RecursivelyWalk("./test262", selectEngine())
+	state.SetSourceCacheSize(*sourceCacheSize)
+	if reference := selectReference(); reference != nil {
+		if err := state.SetReferenceEngine(reference); err != nil {
+			log.Fatalf("Can't use reference engine %s: %s", reference.Name, err.Error())
+		}
+	}
+	if len(*compareProfiles) > 0 {
+		for _, name := range strings.Split(*compareProfiles, ",") {
+			name = strings.TrimSpace(name)
+			if len(name) == 0 {
+				continue
+			}
+			if err := state.AddEngine(findProfile(name)); err != nil {
+				log.Fatalf("Can't use engine profile %s: %s", name, err.Error())
+			}
+		}
+	}
+	Go262Web.SetSpecPath(*specPath)
+	Go262Web.SetRetries(*retries)
+
+	pool := Go262.NewWorkerPool()
+	if len(*watch) > 0 {
+		watcher := Go262.NewWatcher(state, pool, *watch)
+		watcher.WatchTree = *watchTree
+		watcher.Interval = *watchInterval
+		watcher.Settle = *watchSettle
+		watcher.Retries = *retries
+		go watcher.Watch()
+	}
+	if *rescanInterval > 0 {
+		go state.AutoRescan(*rescanInterval)
+	}
+
+	Go262Web.Serve(state, pool)
 }